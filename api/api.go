@@ -1,7 +1,9 @@
 package api
 
 import (
+	"encoding/base64"
 	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/rand"
 	"github.com/stevezaluk/simple-idp-lib/scope"
 )
 
@@ -10,6 +12,8 @@ type TokenType string
 const (
 	RS256 TokenType = "RS256"
 	HS256 TokenType = "HS256"
+	ES256 TokenType = "ES256"
+	EdDSA TokenType = "EdDSA"
 )
 
 /*
@@ -25,17 +29,30 @@ type API struct {
 	// Audience - The audience identifier that will be sent back in tokens
 	Audience string `json:"audience" bson:"audience"`
 
-	// TokenType - The type of JWT's that this API can issue. Can either be RS256 or HS256
+	// TokenType - The type of JWT's that this API can issue. Can be RS256, ES256, EdDSA or HS256
 	TokenType TokenType `json:"token_type" bson:"token_type"`
 
 	// TokenLifetime - The number of seconds in which a token should expire
 	TokenLifetime int `json:"token_lifetime" bson:"token_lifetime"`
 
+	// RefreshTokenLifetime - The number of seconds a refresh token family remains valid for, regardless of use
+	RefreshTokenLifetime int `json:"refresh_token_lifetime" bson:"refresh_token_lifetime"`
+
+	// RefreshTokenIdleLifetime - The number of seconds a refresh token remains valid for if it is not used. Set to 0 to disable
+	RefreshTokenIdleLifetime int `json:"refresh_token_idle_lifetime" bson:"refresh_token_idle_lifetime"`
+
 	// Permissions - Any permissions that this API can utilize
 	Permissions []scope.Scope `json:"permissions" bson:"permissions"`
 
 	// AddPermissions - Determines if permissions should be added to tokens
 	AddPermissions bool `json:"add_permissions" bson:"add_permissions"`
+
+	// IntrospectionClients - The ClientIDs of the applications, usually the resource server itself, that may introspect tokens issued for this API
+	IntrospectionClients []string `json:"introspection_clients" bson:"introspection_clients"`
+
+	// SigningSecret - A base64 encoded 256-bit secret used for signing HS256 tokens. This is never
+	// serialized to JSON so that it cannot be leaked through the API
+	SigningSecret string `json:"-" bson:"signing_secret"`
 }
 
 /*
@@ -47,11 +64,61 @@ func New(name string, audience string, tokenType TokenType) (*API, error) {
 		return nil, err
 	}
 
+	secret, err := rand.Seed(32)
+	if err != nil {
+		return nil, err
+	}
+
 	return &API{
-		Metadata:      meta,
-		Name:          name,
-		Audience:      audience,
-		TokenType:     tokenType,
-		TokenLifetime: 86400,
+		Metadata:                 meta,
+		Name:                     name,
+		Audience:                 audience,
+		TokenType:                tokenType,
+		TokenLifetime:            86400,
+		RefreshTokenLifetime:     2592000,
+		RefreshTokenIdleLifetime: 1296000,
+		SigningSecret:            base64.URLEncoding.EncodeToString(secret),
 	}, nil
 }
+
+/*
+FilterPermissions - Returns the names of the scopes passed in the requested parameter that
+are also defined in API.Permissions. Scopes that the API does not define are dropped
+*/
+func (api *API) FilterPermissions(requested []string) []string {
+	var ret []string
+
+	for _, name := range requested {
+		if api.HasPermission(name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret
+}
+
+/*
+HasPermission - Returns true if the API defines a scope with the name passed in the name parameter
+*/
+func (api *API) HasPermission(name string) bool {
+	for _, permission := range api.Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+PermissionNames - Returns the names of every scope defined in API.Permissions
+*/
+func (api *API) PermissionNames() []string {
+	var ret []string
+
+	for _, permission := range api.Permissions {
+		ret = append(ret, permission.Name)
+	}
+
+	return ret
+}
@@ -0,0 +1,182 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrAPIAlreadyExists - Gets returned by CreateAPI and ReplaceAPI when another API already uses the same audience
+var ErrAPIAlreadyExists = errors.New("api: Already exists")
+
+// ErrAPIDoesNotExist - Gets returned by GetAPIByAudience, GetAPIByID, ReplaceAPI and DeleteAPI when an API does not exist
+var ErrAPIDoesNotExist = errors.New("api: Does not exist")
+
+// ErrFetchAPIFailed - Serves as a wrapper around database errors for the GetAPIByAudience, GetAPIByID and ListAPIs functions
+var ErrFetchAPIFailed = errors.New("api: Failed to fetch API")
+
+// ErrCreateAPIFailed - Serves as a wrapper around database errors for the CreateAPI function
+var ErrCreateAPIFailed = errors.New("api: Failed to create API")
+
+// ErrReplaceAPIFailed - Serves as a wrapper around database errors for the ReplaceAPI function
+var ErrReplaceAPIFailed = errors.New("api: Failed to replace API")
+
+// ErrDeleteAPIFailed - Serves as a wrapper around database errors for the DeleteAPI function
+var ErrDeleteAPIFailed = errors.New("api: Failed to delete API")
+
+/*
+GetAPIByAudience - Fetch an API using its audience identifier
+*/
+func GetAPIByAudience(database *server.Database, audience string) (*API, error) {
+	var ret API
+
+	err := database.Find("api", bson.M{"audience": audience}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchAPIFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+GetAPIByID - Fetch an API using its Metadata.Id
+*/
+func GetAPIByID(database *server.Database, id string) (*API, error) {
+	var ret API
+
+	err := database.Find("api", bson.M{"metadata.id": id}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrAPIDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchAPIFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+CheckAPIExists - Check to see if an API with the audience passed in the audience parameter already exists in the database
+*/
+func CheckAPIExists(database *server.Database, audience string) (bool, error) {
+	ok, err := database.Exists("api", bson.M{"audience": audience})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateAPI - Insert a new API into the database, and return any errors that may occur. The audience
+must be unique
+*/
+func CreateAPI(database *server.Database, api *API) error {
+	ok, err := CheckAPIExists(database, api.Audience)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateAPIFailed, err)
+	}
+
+	if ok {
+		return ErrAPIAlreadyExists
+	}
+
+	err = database.Insert("api", api)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateAPIFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceAPI - Replace an API with the model passed in the api parameter. The Metadata.Id of the model
+is used to signify which API to replace, so that its audience can be changed as long as it stays unique
+*/
+func ReplaceAPI(database *server.Database, api *API) error {
+	ok, err := database.Exists("api", bson.M{"metadata.id": api.Metadata.Id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceAPIFailed, err)
+	}
+
+	if !ok {
+		return ErrAPIDoesNotExist
+	}
+
+	taken, err := database.Exists("api", bson.M{"audience": api.Audience, "metadata.id": bson.M{"$ne": api.Metadata.Id}})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceAPIFailed, err)
+	}
+
+	if taken {
+		return ErrAPIAlreadyExists
+	}
+
+	err = database.Replace("api", bson.M{"metadata.id": api.Metadata.Id}, api)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceAPIFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteAPI - Remove a single API from the database using its audience. Any client grants for the
+API are left behind, so grant.DeleteAPI should be used instead
+*/
+func DeleteAPI(database *server.Database, audience string) error {
+	ok, err := CheckAPIExists(database, audience)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteAPIFailed, err)
+	}
+
+	if !ok {
+		return ErrAPIDoesNotExist
+	}
+
+	err = database.Delete("api", bson.M{"audience": audience})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteAPIFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ListAPIs - Fetch all API's that are stored in the database
+*/
+func ListAPIs(database *server.Database) ([]*API, error) {
+	var ret []*API
+
+	err := database.FindMany("api", bson.M{}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchAPIFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+GetMaxTokenLifetime - Returns the largest TokenLifetime of every API stored in the database. This
+is the longest amount of time a token issued by simple-idp can remain valid for
+*/
+func GetMaxTokenLifetime(database *server.Database) (int, error) {
+	apis, err := ListAPIs(database)
+	if err != nil {
+		return 0, err
+	}
+
+	ret := 0
+	for _, api := range apis {
+		if api.TokenLifetime > ret {
+			ret = api.TokenLifetime
+		}
+	}
+
+	return ret, nil
+}
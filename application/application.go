@@ -1,20 +1,74 @@
 package application
 
 import (
-	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
-	"encoding/hex"
+	"errors"
+	"github.com/stevezaluk/simple-idp-lib/key"
 	"github.com/stevezaluk/simple-idp-lib/metadata"
 	"github.com/stevezaluk/simple-idp-lib/rand"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"net"
+	"slices"
+	"strings"
 )
 
+// ErrNoPublicKeys - Gets returned by Application.PublicKeys when the application has not registered a JWKS or JWKSURI
+var ErrNoPublicKeys = errors.New("application: Application has not registered any public keys")
+
 type GrantType string
 
 const (
 	ClientCredentials     GrantType = "client_credentials"
 	AuthorizationCodePKCE GrantType = "authorization_code"
+	RefreshToken          GrantType = "refresh_token"
+	DeviceCode            GrantType = "urn:ietf:params:oauth:grant-type:device_code"
+	TokenExchange         GrantType = "urn:ietf:params:oauth:grant-type:token-exchange"
 )
 
+// GrantTypes - Every grant type that simple-idp supports
+var GrantTypes = []GrantType{ClientCredentials, AuthorizationCodePKCE, RefreshToken, DeviceCode, TokenExchange}
+
+type AuthMethod string
+
+const (
+	// ClientSecretBasic - The application authenticates with its ClientSecret using HTTP Basic authentication
+	ClientSecretBasic AuthMethod = "client_secret_basic"
+
+	// ClientSecretPost - The application authenticates with its ClientSecret using form parameters
+	ClientSecretPost AuthMethod = "client_secret_post"
+
+	// None - The application is a public client and cannot authenticate. It must use PKCE
+	None AuthMethod = "none"
+
+	// TLSClientAuth - The application authenticates with a client certificate issued by a trusted certificate authority
+	TLSClientAuth AuthMethod = "tls_client_auth"
+
+	// SelfSignedTLSClientAuth - The application authenticates with a self-signed client certificate registered in its JWKS
+	SelfSignedTLSClientAuth AuthMethod = "self_signed_tls_client_auth"
+
+	// PrivateKeyJWT - The application authenticates with a JWT signed by one of the keys registered in its JWKS
+	PrivateKeyJWT AuthMethod = "private_key_jwt"
+
+	// ClientSecretJWT - The application authenticates with a JWT signed with an HMAC of its client secret. As only
+	// a hash of each secret is stored, the secret must also be sealed with ClientSecret.SealHMACKey when it is issued
+	ClientSecretJWT AuthMethod = "client_secret_jwt"
+)
+
+// AuthMethods - Every client authentication method that simple-idp supports
+var AuthMethods = []AuthMethod{ClientSecretBasic, ClientSecretPost, None, TLSClientAuth, SelfSignedTLSClientAuth, PrivateKeyJWT, ClientSecretJWT}
+
+/*
+TokenExchangePolicy - Controls how an application may use the token exchange grant
+*/
+type TokenExchangePolicy struct {
+	// Audiences - The audiences of the API's that the application may exchange tokens into
+	Audiences []string `json:"audiences" bson:"audiences"`
+
+	// AllowImpersonation - If true, the application may exchange a token without providing an actor_token
+	AllowImpersonation bool `json:"allow_impersonation" bson:"allow_impersonation"`
+}
+
 /*
 Application - A user defined application. Users will define these and authorize there applications
 to use API's that are defined
@@ -26,59 +80,261 @@ type Application struct {
 	// Name - The name of the Application
 	Name string `json:"name" bson:"name"`
 
+	// Type - The kind of application. Determines which grant types and auth methods it may use
+	Type Type `json:"type" bson:"type"`
+
 	// GrantType - The OAuth grant type that you want to assign to this application
 	GrantType []GrantType `json:"grant_type" bson:"grant_type"`
 
 	// ClientID - A base64 random string representing the clientId
 	ClientID string `json:"client_id" bson:"client_id"`
 
-	// ClientSecret - A 256-bit random string
-	ClientSecret string `json:"client_secret" bson:"client_secret"`
+	// ClientSecrets - The secrets the application can authenticate with. Several can be valid at once while a secret is rotated
+	ClientSecrets []*ClientSecret `json:"client_secrets" bson:"client_secrets"`
+
+	// TokenEndpointAuthMethod - The method the application uses to authenticate at the token endpoint
+	TokenEndpointAuthMethod AuthMethod `json:"token_endpoint_auth_method" bson:"token_endpoint_auth_method"`
+
+	// RedirectURIs - The URIs that users can be redirected back to after authorizing the application
+	RedirectURIs []string `json:"redirect_uris" bson:"redirect_uris"`
+
+	// PostLogoutRedirectURIs - The URIs that users can be redirected back to after signing out
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris" bson:"post_logout_redirect_uris"`
+
+	// AllowedOrigins - The origins that browser based applications can make cross-origin requests from
+	AllowedOrigins []string `json:"allowed_origins" bson:"allowed_origins"`
+
+	// AllowWildcardSubdomains - If true, registered https hosts may start with a *. label that matches a single subdomain
+	AllowWildcardSubdomains bool `json:"allow_wildcard_subdomains" bson:"allow_wildcard_subdomains"`
+
+	// RequirePushedAuthorizationRequests - If true, the authorization endpoint only accepts requests pushed to the PAR endpoint
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests" bson:"require_pushed_authorization_requests"`
+
+	// JWKS - The public keys the application signs request objects and client assertions with
+	JWKS *key.JWKSet `json:"jwks,omitempty" bson:"jwks,omitempty"`
+
+	// JWKSURI - A URL where the application serves its public keys. Only used if JWKS is not set
+	JWKSURI string `json:"jwks_uri" bson:"jwks_uri"`
+
+	// RequestURIs - The URLs the application may pass in the request_uri parameter to reference a request object
+	RequestURIs []string `json:"request_uris" bson:"request_uris"`
+
+	// TLSClientAuthSubjectDN - The subject DN the client certificate must have. Used with TLSClientAuth
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn" bson:"tls_client_auth_subject_dn"`
+
+	// TLSClientAuthSANDNS - A DNS name the client certificate must have as a SAN. Used with TLSClientAuth
+	TLSClientAuthSANDNS string `json:"tls_client_auth_san_dns" bson:"tls_client_auth_san_dns"`
+
+	// TLSClientAuthSANURI - A URI the client certificate must have as a SAN. Used with TLSClientAuth
+	TLSClientAuthSANURI string `json:"tls_client_auth_san_uri" bson:"tls_client_auth_san_uri"`
+
+	// TLSClientAuthSANIP - An IP address the client certificate must have as a SAN. Used with TLSClientAuth
+	TLSClientAuthSANIP string `json:"tls_client_auth_san_ip" bson:"tls_client_auth_san_ip"`
+
+	// TLSClientAuthSANEmail - An email address the client certificate must have as a SAN. Used with TLSClientAuth
+	TLSClientAuthSANEmail string `json:"tls_client_auth_san_email" bson:"tls_client_auth_san_email"`
+
+	// TLSClientCertificateBoundAccessTokens - If true, tokens issued to the application are bound to its client certificate
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens" bson:"tls_client_certificate_bound_access_tokens"`
+
+	// TokenExchange - Which audiences the application may exchange tokens into. Token exchange is denied if nil
+	TokenExchange *TokenExchangePolicy `json:"token_exchange" bson:"token_exchange"`
+
+	// RegistrationAccessTokenHash - The hex encoded SHA-256 hash of the RFC 7592 registration access token. Empty if the application was not dynamically registered
+	RegistrationAccessTokenHash string `json:"-" bson:"registration_access_token_hash"`
 }
 
 /*
-New - A constructor for the Application struct
+New - A constructor for the Application struct. The grant types and auth method are validated against
+the type passed in the clientType parameter, and the type's defaults are used if grantType is empty.
+Confidential clients are given a client secret that never expires, hashed using the parameters passed
+in the params parameter. The secret is returned, and is the only time it is available. Public clients
+are not given a secret, and an empty string is returned
 */
-func New(name string, grantType []GrantType) (*Application, error) {
+func New(name string, clientType Type, grantType []GrantType, params *user.HashingParameters) (*Application, string, error) {
 	meta, err := metadata.New()
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	if len(grantType) == 0 {
+		grantType = clientType.DefaultGrantTypes()
 	}
 
 	app := &Application{
-		Metadata:  meta,
-		Name:      name,
-		GrantType: grantType,
+		Metadata:                meta,
+		Name:                    name,
+		Type:                    clientType,
+		GrantType:               grantType,
+		TokenEndpointAuthMethod: clientType.DefaultAuthMethod(),
+	}
+
+	err = app.validateType()
+	if err != nil {
+		return nil, "", err
+	}
+
+	clientIdSeed, err := rand.Seed(64)
+	if err != nil {
+		return nil, "", err
+	}
+
+	app.ClientID = base64.URLEncoding.EncodeToString(clientIdSeed)
+
+	if clientType.IsPublic() {
+		return app, "", nil
 	}
 
-	err = app.generateClientCredentials()
+	_, secret, err := app.AddClientSecret(params, 0)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	return app, nil
+	return app, secret, nil
 }
 
 /*
-generateClientCredentials - Generates a new ClientID and ClientSecret for
-the application to use
+HasGrantType - Returns true if the application is allowed to use the grant type passed
+in the grantType parameter
 */
-func (application *Application) generateClientCredentials() error {
+func (application *Application) HasGrantType(grantType GrantType) bool {
+	for _, allowed := range application.GrantType {
+		if allowed == grantType {
+			return true
+		}
+	}
 
-	clientIdSeed, err := rand.Seed(64)
-	if err != nil {
-		return err
+	return false
+}
+
+/*
+ValidateClientSecret - Validates if the secret passed in the secret parameter matches one of the
+ClientSecrets of the application that has not expired. The secret is hashed with the parameters
+each ClientSecret was created with, and the hashes are compared in constant time to prevent timing
+based attacks
+*/
+func (application *Application) ValidateClientSecret(secret string) bool {
+	return application.MatchClientSecret(secret) != nil
+}
+
+/*
+IsPublic - Returns true if the application is a public client that cannot keep a secret
+*/
+func (application *Application) IsPublic() bool {
+	return application.TokenEndpointAuthMethod == None
+}
+
+/*
+UsesClientSecret - Returns true if the TokenEndpointAuthMethod of the application authenticates with one of its ClientSecrets
+*/
+func (application *Application) UsesClientSecret() bool {
+	switch application.TokenEndpointAuthMethod {
+	case ClientSecretBasic, ClientSecretPost, ClientSecretJWT:
+		return true
+	}
+
+	return false
+}
+
+/*
+CanExchangeTo - Returns true if the token exchange policy of the application allows exchanging
+tokens into the audience passed in the audience parameter
+*/
+func (application *Application) CanExchangeTo(audience string) bool {
+	if application.TokenExchange == nil {
+		return false
+	}
+
+	for _, allowed := range application.TokenExchange.Audiences {
+		if allowed == audience {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+PublicKeys - Returns the public keys of the application. Keys registered inline take precedence
+over the JWKSURI. The refresh parameter is passed through to key.FetchJWKSet
+*/
+func (application *Application) PublicKeys(refresh bool) (*key.JWKSet, error) {
+	if application.JWKS != nil && len(application.JWKS.Keys) != 0 {
+		return application.JWKS, nil
+	}
+
+	if application.JWKSURI == "" {
+		return nil, ErrNoPublicKeys
+	}
+
+	return key.FetchJWKSet(application.JWKSURI, refresh)
+}
+
+/*
+HasRequestURI - Returns true if the URI passed in the requestUri parameter has been registered
+with the application. The fragment is ignored, as RFC 9101 allows it to be used to identify
+different versions of the request object
+*/
+func (application *Application) HasRequestURI(requestUri string) bool {
+	requestUri, _, _ = strings.Cut(requestUri, "#")
+
+	for _, registered := range application.RequestURIs {
+		if registered == requestUri {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+MatchesCertificate - Returns true if the certificate passed in the cert parameter matches the subject
+DN or SAN registered with the application, as described in RFC 8705 Section 2.1.2. The chain of the
+certificate must be verified separately
+*/
+func (application *Application) MatchesCertificate(cert *x509.Certificate) bool {
+	switch {
+	case application.TLSClientAuthSubjectDN != "":
+		return cert.Subject.String() == application.TLSClientAuthSubjectDN
+	case application.TLSClientAuthSANDNS != "":
+		return slices.Contains(cert.DNSNames, application.TLSClientAuthSANDNS)
+	case application.TLSClientAuthSANURI != "":
+		for _, uri := range cert.URIs {
+			if uri.String() == application.TLSClientAuthSANURI {
+				return true
+			}
+		}
+	case application.TLSClientAuthSANIP != "":
+		ip := net.ParseIP(application.TLSClientAuthSANIP)
+		for _, address := range cert.IPAddresses {
+			if ip != nil && address.Equal(ip) {
+				return true
+			}
+		}
+	case application.TLSClientAuthSANEmail != "":
+		return slices.Contains(cert.EmailAddresses, application.TLSClientAuthSANEmail)
 	}
 
-	clientSecretSeed, err := rand.Seed(64)
+	return false
+}
+
+/*
+HasCertificate - Returns true if the certificate passed in the cert parameter is registered in
+the JWKS of the application, in the x5c member of one of its keys. Used with SelfSignedTLSClientAuth
+*/
+func (application *Application) HasCertificate(cert *x509.Certificate) (bool, error) {
+	set, err := application.PublicKeys(false)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	clientSecret := sha256.New()
+	encoded := base64.StdEncoding.EncodeToString(cert.Raw)
 
-	application.ClientID = base64.URLEncoding.EncodeToString(clientIdSeed)
-	application.ClientSecret = hex.EncodeToString(clientSecret.Sum(clientSecretSeed))
+	for _, jwk := range set.Keys {
+		if len(jwk.X5C) != 0 && jwk.X5C[0] == encoded {
+			return true, nil
+		}
+	}
 
-	return nil
+	return false, nil
 }
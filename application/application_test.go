@@ -0,0 +1,94 @@
+package application
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+/*
+newTestCertificate - Create a self-signed certificate with the subject and SANs that
+MatchesCertificate is tested against
+*/
+func newTestCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spiffe, err := url.Parse("spiffe://example.com/client")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(1),
+		Subject:        pkix.Name{CommonName: "client", Organization: []string{"Example"}},
+		NotBefore:      time.Now().Add(-time.Hour),
+		NotAfter:       time.Now().Add(time.Hour),
+		DNSNames:       []string{"client.example.com"},
+		URIs:           []*url.URL{spiffe},
+		IPAddresses:    []net.IP{net.ParseIP("192.0.2.10")},
+		EmailAddresses: []string{"client@example.com"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private.PublicKey, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestMatchesCertificate(t *testing.T) {
+	cert := newTestCertificate(t)
+
+	tests := []struct {
+		name        string
+		application *Application
+		want        bool
+	}{
+		{name: "subject DN", application: &Application{TLSClientAuthSubjectDN: "CN=client,O=Example"}, want: true},
+		{name: "wrong subject DN", application: &Application{TLSClientAuthSubjectDN: "CN=other,O=Example"}, want: false},
+		{name: "partial subject DN", application: &Application{TLSClientAuthSubjectDN: "CN=client"}, want: false},
+		{name: "DNS SAN", application: &Application{TLSClientAuthSANDNS: "client.example.com"}, want: true},
+		{name: "wrong DNS SAN", application: &Application{TLSClientAuthSANDNS: "other.example.com"}, want: false},
+		{name: "DNS SAN suffix", application: &Application{TLSClientAuthSANDNS: "example.com"}, want: false},
+		{name: "URI SAN", application: &Application{TLSClientAuthSANURI: "spiffe://example.com/client"}, want: true},
+		{name: "wrong URI SAN", application: &Application{TLSClientAuthSANURI: "spiffe://example.com/other"}, want: false},
+		{name: "IP SAN", application: &Application{TLSClientAuthSANIP: "192.0.2.10"}, want: true},
+		{name: "IP SAN mapped", application: &Application{TLSClientAuthSANIP: "::ffff:192.0.2.10"}, want: true},
+		{name: "wrong IP SAN", application: &Application{TLSClientAuthSANIP: "192.0.2.11"}, want: false},
+		{name: "invalid IP SAN", application: &Application{TLSClientAuthSANIP: "not-an-ip"}, want: false},
+		{name: "email SAN", application: &Application{TLSClientAuthSANEmail: "client@example.com"}, want: true},
+		{name: "wrong email SAN", application: &Application{TLSClientAuthSANEmail: "other@example.com"}, want: false},
+		{name: "nothing registered", application: &Application{}, want: false},
+		{
+			name:        "subject DN takes precedence",
+			application: &Application{TLSClientAuthSubjectDN: "CN=other", TLSClientAuthSANDNS: "client.example.com"},
+			want:        false,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.application.MatchesCertificate(cert); got != test.want {
+				t.Fatalf("MatchesCertificate() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
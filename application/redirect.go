@@ -0,0 +1,199 @@
+package application
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+/*
+HasRedirectURI - Returns true if the URI passed in the redirectUri parameter matches one of the
+RedirectURIs registered with the application. See matchURI for how URIs are compared
+*/
+func (application *Application) HasRedirectURI(redirectUri string) bool {
+	return matchURI(application.RedirectURIs, redirectUri, application.AllowWildcardSubdomains)
+}
+
+/*
+HasPostLogoutRedirectURI - Returns true if the URI passed in the redirectUri parameter matches one of
+the PostLogoutRedirectURIs registered with the application. See matchURI for how URIs are compared
+*/
+func (application *Application) HasPostLogoutRedirectURI(redirectUri string) bool {
+	return matchURI(application.PostLogoutRedirectURIs, redirectUri, application.AllowWildcardSubdomains)
+}
+
+/*
+HasOrigin - Returns true if the origin passed in the origin parameter matches one of the AllowedOrigins
+registered with the application. See matchURI for how origins are compared
+*/
+func (application *Application) HasOrigin(origin string) bool {
+	return matchURI(application.AllowedOrigins, origin, application.AllowWildcardSubdomains)
+}
+
+/*
+matchURI - Returns true if the URI passed in the uri parameter matches one of the registered URIs.
+URIs are compared using simple string comparison, with two exceptions. The port of a registered
+loopback URI is ignored, as native applications are assigned a port by the operating system at
+runtime (RFC 8252 Section 7.3). If wildcard is true, a registered host of the form *.example.com
+matches exactly one additional label, such as app.example.com. Paths are always compared in their
+escaped form, so /c%62 does not match /cb
+*/
+func matchURI(registered []string, uri string, wildcard bool) bool {
+	for _, candidate := range registered {
+		if candidate == uri {
+			return true
+		}
+	}
+
+	presented, err := url.Parse(uri)
+	if err != nil || presented.User != nil || presented.Fragment != "" {
+		return false
+	}
+
+	for _, candidate := range registered {
+		expected, err := url.Parse(candidate)
+		if err != nil {
+			continue
+		}
+
+		if expected.Scheme != presented.Scheme || expected.EscapedPath() != presented.EscapedPath() || expected.RawQuery != presented.RawQuery {
+			continue
+		}
+
+		if expected.Scheme == "http" && isLoopback(expected.Hostname()) {
+			if expected.Hostname() == presented.Hostname() {
+				return true
+			}
+
+			continue
+		}
+
+		suffix, ok := strings.CutPrefix(expected.Hostname(), "*")
+		if !wildcard || !ok || expected.Port() != presented.Port() {
+			continue
+		}
+
+		label, ok := strings.CutSuffix(presented.Hostname(), suffix)
+		if ok && label != "" && !strings.ContainsAny(label, ".*") {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+validateRedirectURI - Ensure a redirect URI can be safely redirected to. URIs must be absolute and
+cannot contain a fragment. https is required, except for loopback URIs, and private-use URI schemes
+are accepted for native applications as long as they follow the reverse domain name format described
+in RFC 8252 Section 7.1
+*/
+func validateRedirectURI(raw string, wildcard bool) error {
+	if strings.Contains(raw, "#") {
+		return fmt.Errorf("%w: %q contains a fragment", ErrInvalidRedirectURI, raw)
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil || !parsed.IsAbs() {
+		return fmt.Errorf("%w: %q is not an absolute URI", ErrInvalidRedirectURI, raw)
+	}
+
+	if parsed.User != nil {
+		return fmt.Errorf("%w: %q contains user information", ErrInvalidRedirectURI, raw)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return validateHost(raw, parsed, wildcard)
+	case "http":
+		if !isLoopback(parsed.Hostname()) {
+			return fmt.Errorf("%w: %q must use https, only loopback URIs may use http", ErrInvalidRedirectURI, raw)
+		}
+	default:
+		if !strings.Contains(parsed.Scheme, ".") {
+			return fmt.Errorf("%w: %q must use a private-use scheme in reverse domain name format", ErrInvalidRedirectURI, raw)
+		}
+
+		if parsed.Host != "" {
+			return fmt.Errorf("%w: %q cannot contain an authority, private-use URIs must have a single slash after the scheme", ErrInvalidRedirectURI, raw)
+		}
+	}
+
+	if strings.Contains(raw, "*") {
+		return fmt.Errorf("%w: %q contains a wildcard, which is only allowed in https hosts", ErrInvalidRedirectURI, raw)
+	}
+
+	return nil
+}
+
+/*
+validateOrigin - Ensure an origin is a scheme, host and optional port only. Origins follow the same
+https and loopback rules as redirect URIs
+*/
+func validateOrigin(raw string, wildcard bool) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("%w: %q is not a valid origin", ErrInvalidMetadata, raw)
+	}
+
+	if parsed.User != nil || parsed.Path != "" || parsed.RawQuery != "" || strings.Contains(raw, "#") {
+		return fmt.Errorf("%w: origin %q can only contain a scheme, host and port", ErrInvalidMetadata, raw)
+	}
+
+	switch {
+	case parsed.Scheme == "https":
+		err = validateHost(raw, parsed, wildcard)
+		if err != nil {
+			return fmt.Errorf("%w: origin %q has an invalid wildcard host", ErrInvalidMetadata, raw)
+		}
+	case parsed.Scheme == "http" && isLoopback(parsed.Hostname()):
+	default:
+		return fmt.Errorf("%w: origin %q must use https, only loopback origins may use http", ErrInvalidMetadata, raw)
+	}
+
+	return nil
+}
+
+/*
+validateHost - Ensure any wildcard in an https host is a single leading label, that it is not
+directly above a top level domain, and that wildcards are enabled for the application
+*/
+func validateHost(raw string, parsed *url.URL, wildcard bool) error {
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("%w: %q has no host", ErrInvalidRedirectURI, raw)
+	}
+
+	if strings.Contains(strings.Replace(raw, host, "", 1), "*") {
+		return fmt.Errorf("%w: %q contains a wildcard outside of the host", ErrInvalidRedirectURI, raw)
+	}
+
+	if !strings.Contains(host, "*") {
+		return nil
+	}
+
+	if !wildcard {
+		return fmt.Errorf("%w: %q contains a wildcard, but wildcard subdomains are not enabled", ErrInvalidRedirectURI, raw)
+	}
+
+	suffix, ok := strings.CutPrefix(host, "*.")
+	if !ok || strings.Contains(suffix, "*") || strings.Count(suffix, ".") < 1 {
+		return fmt.Errorf("%w: %q must use a wildcard of the form *.example.com", ErrInvalidRedirectURI, raw)
+	}
+
+	return nil
+}
+
+/*
+isLoopback - Returns true if the host passed in the host parameter refers to the loopback interface
+*/
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
@@ -0,0 +1,91 @@
+package application
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMatchURI(t *testing.T) {
+	tests := []struct {
+		name       string
+		registered []string
+		uri        string
+		wildcard   bool
+		want       bool
+	}{
+		{name: "exact", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com/cb", want: true},
+		{name: "different path", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com/other", want: false},
+		{name: "trailing slash", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com/cb/", want: false},
+		{name: "encoded path", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com/c%62", want: false},
+		{name: "encoded registered path", registered: []string{"https://app.example.com/c%62"}, uri: "https://app.example.com/cb", want: false},
+		{name: "different query", registered: []string{"https://app.example.com/cb?a=1"}, uri: "https://app.example.com/cb?a=2", want: false},
+		{name: "fragment", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com/cb#x", want: false},
+		{name: "user information", registered: []string{"https://app.example.com/cb"}, uri: "https://evil@app.example.com/cb", want: false},
+		{name: "loopback any port", registered: []string{"http://127.0.0.1/cb"}, uri: "http://127.0.0.1:51004/cb", want: true},
+		{name: "loopback different path", registered: []string{"http://127.0.0.1/cb"}, uri: "http://127.0.0.1:51004/c%62", want: false},
+		{name: "loopback different host", registered: []string{"http://127.0.0.1/cb"}, uri: "http://localhost:51004/cb", want: false},
+		{name: "https port is not ignored", registered: []string{"https://app.example.com/cb"}, uri: "https://app.example.com:8443/cb", want: false},
+		{name: "wildcard", registered: []string{"https://*.example.com/cb"}, uri: "https://app.example.com/cb", wildcard: true, want: true},
+		{name: "wildcard disabled", registered: []string{"https://*.example.com/cb"}, uri: "https://app.example.com/cb", want: false},
+		{name: "wildcard two labels", registered: []string{"https://*.example.com/cb"}, uri: "https://a.b.example.com/cb", wildcard: true, want: false},
+		{name: "wildcard bare domain", registered: []string{"https://*.example.com/cb"}, uri: "https://example.com/cb", wildcard: true, want: false},
+		{name: "wildcard suffix attack", registered: []string{"https://*.example.com/cb"}, uri: "https://appexample.com/cb", wildcard: true, want: false},
+		{name: "wildcard encoded path", registered: []string{"https://*.example.com/cb"}, uri: "https://app.example.com/c%62", wildcard: true, want: false},
+		{name: "private-use scheme", registered: []string{"com.example.app:/cb"}, uri: "com.example.app:/cb", want: true},
+		{name: "nothing registered", uri: "https://app.example.com/cb", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := matchURI(test.registered, test.uri, test.wildcard); got != test.want {
+				t.Fatalf("matchURI() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateRedirectURI(t *testing.T) {
+	tests := []struct {
+		name     string
+		uri      string
+		wildcard bool
+		wantErr  bool
+	}{
+		{name: "https", uri: "https://app.example.com/cb"},
+		{name: "https with query", uri: "https://app.example.com/cb?a=1"},
+		{name: "loopback http", uri: "http://127.0.0.1/cb"},
+		{name: "localhost http", uri: "http://localhost:8080/cb"},
+		{name: "ipv6 loopback http", uri: "http://[::1]/cb"},
+		{name: "private-use scheme", uri: "com.example.app:/cb"},
+		{name: "wildcard", uri: "https://*.example.com/cb", wildcard: true},
+		{name: "relative", uri: "/cb", wantErr: true},
+		{name: "fragment", uri: "https://app.example.com/cb#x", wantErr: true},
+		{name: "empty fragment", uri: "https://app.example.com/cb#", wantErr: true},
+		{name: "user information", uri: "https://user@app.example.com/cb", wantErr: true},
+		{name: "plain http", uri: "http://app.example.com/cb", wantErr: true},
+		{name: "https without host", uri: "https:///cb", wantErr: true},
+		{name: "private-use scheme without dot", uri: "myapp:/cb", wantErr: true},
+		{name: "private-use scheme with authority", uri: "com.example.app://cb", wantErr: true},
+		{name: "wildcard disabled", uri: "https://*.example.com/cb", wantErr: true},
+		{name: "wildcard above top level domain", uri: "https://*.com/cb", wildcard: true, wantErr: true},
+		{name: "wildcard in middle label", uri: "https://app.*.example.com/cb", wildcard: true, wantErr: true},
+		{name: "wildcard in path", uri: "https://app.example.com/*", wildcard: true, wantErr: true},
+		{name: "wildcard on loopback", uri: "http://*.localhost/cb", wildcard: true, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateRedirectURI(test.uri, test.wildcard)
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidRedirectURI) {
+					t.Fatalf("expected ErrInvalidRedirectURI, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
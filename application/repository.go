@@ -0,0 +1,206 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"time"
+)
+
+// clientSecretUseInterval - How often the LastUsedAt of a client secret is written to the database
+const clientSecretUseInterval = time.Minute
+
+// ErrApplicationDoesNotExist - Gets returned by GetApplicationByClientID, GetApplicationByID, ReplaceApplication and DeleteApplication when an application does not exist
+var ErrApplicationDoesNotExist = errors.New("application: Does not exist")
+
+// ErrApplicationAlreadyExists - Gets returned by CreateApplication when an application with the same ClientID already exists
+var ErrApplicationAlreadyExists = errors.New("application: Already exists")
+
+// ErrFetchApplicationFailed - Serves as a wrapper around database errors for the GetApplicationByClientID, GetApplicationByID and ListApplications functions
+var ErrFetchApplicationFailed = errors.New("application: Failed to fetch application")
+
+// ErrCreateApplicationFailed - Serves as a wrapper around database errors for the CreateApplication function
+var ErrCreateApplicationFailed = errors.New("application: Failed to create application")
+
+// ErrReplaceApplicationFailed - Serves as a wrapper around database errors for the ReplaceApplication function
+var ErrReplaceApplicationFailed = errors.New("application: Failed to replace application")
+
+// ErrUpdateClientSecretFailed - Serves as a wrapper around database errors for the RecordClientSecretUse function
+var ErrUpdateClientSecretFailed = errors.New("application: Failed to update client secret")
+
+// ErrDeleteApplicationFailed - Serves as a wrapper around database errors for the DeleteApplication function
+var ErrDeleteApplicationFailed = errors.New("application: Failed to delete application")
+
+/*
+GetApplicationByClientID - Fetch an application using its ClientID
+*/
+func GetApplicationByClientID(database *server.Database, clientId string) (*Application, error) {
+	var ret Application
+
+	err := database.Find("application", bson.M{"client_id": clientId}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrApplicationDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchApplicationFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+GetApplicationByID - Fetch an application using its Metadata.Id
+*/
+func GetApplicationByID(database *server.Database, id string) (*Application, error) {
+	var ret Application
+
+	err := database.Find("application", bson.M{"metadata.id": id}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrApplicationDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchApplicationFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+ListApplications - Fetch all applications that are stored in the database
+*/
+func ListApplications(database *server.Database) ([]*Application, error) {
+	var ret []*Application
+
+	err := database.FindMany("application", bson.M{}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchApplicationFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+CheckApplicationExists - Check to see if an application already exists in the database
+*/
+func CheckApplicationExists(database *server.Database, clientId string) (bool, error) {
+	ok, err := database.Exists("application", bson.M{"client_id": clientId})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateApplication - Insert a new application into the database, and return any errors that may occur
+*/
+func CreateApplication(database *server.Database, application *Application) error {
+	ok, err := CheckApplicationExists(database, application.ClientID)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateApplicationFailed, err)
+	}
+
+	if ok {
+		return ErrApplicationAlreadyExists
+	}
+
+	err = database.Insert("application", application)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateApplicationFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceApplication - Replace an application with the model passed in the application parameter. The
+ClientID of the model is used to signify which application to replace
+*/
+func ReplaceApplication(database *server.Database, application *Application) error {
+	ok, err := CheckApplicationExists(database, application.ClientID)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceApplicationFailed, err)
+	}
+
+	if !ok {
+		return ErrApplicationDoesNotExist
+	}
+
+	err = database.Replace("application", bson.M{"client_id": application.ClientID}, application)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceApplicationFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteApplication - Remove a single application from the database using its ClientID. Any client
+grants given to the application are left behind, so grant.DeleteApplication should be used instead
+*/
+func DeleteApplication(database *server.Database, clientId string) error {
+	ok, err := CheckApplicationExists(database, clientId)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteApplicationFailed, err)
+	}
+
+	if !ok {
+		return ErrApplicationDoesNotExist
+	}
+
+	err = database.Delete("application", bson.M{"client_id": clientId})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteApplicationFailed, err)
+	}
+
+	return nil
+}
+
+/*
+RecordClientSecretUse - Set the LastUsedAt of the secret passed in the secret parameter to the current
+time. To avoid a write on every request, the database is only updated if the secret has not been
+recorded as used in the last minute
+*/
+func RecordClientSecretUse(database *server.Database, clientId string, secret *ClientSecret) error {
+	now := time.Now().UTC()
+	if now.Sub(secret.LastUsedAt) < clientSecretUseInterval {
+		return nil
+	}
+
+	secret.LastUsedAt = now
+
+	err := database.Update(
+		"application",
+		bson.M{"client_id": clientId, "client_secrets.id": secret.ID},
+		bson.M{"$set": bson.M{"client_secrets.$.last_used_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrUpdateClientSecretFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ListApplicationsWithExpiringSecrets - Fetch every application that holds a client secret that is still
+valid, but expires within the duration passed in the within parameter. Use
+Application.ExpiringClientSecrets to find which of its secrets are expiring
+*/
+func ListApplicationsWithExpiringSecrets(database *server.Database, within time.Duration) ([]*Application, error) {
+	var ret []*Application
+
+	now := time.Now().UTC()
+
+	query := bson.M{"client_secrets": bson.M{"$elemMatch": bson.M{
+		"expires_at": bson.M{"$gt": now, "$lt": now.Add(within)},
+	}}}
+
+	err := database.FindMany("application", query, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchApplicationFailed, err)
+	}
+
+	return ret, nil
+}
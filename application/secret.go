@@ -0,0 +1,268 @@
+package application
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/rand"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"slices"
+	"time"
+)
+
+// ErrClientSecretDoesNotExist - Gets returned by Application.RevokeClientSecret when no secret has the requested ID
+var ErrClientSecretDoesNotExist = errors.New("application: Client secret does not exist")
+
+// ErrInvalidEncryptionKey - Gets returned by ClientSecret.SealHMACKey and ClientSecret.OpenHMACKey when the encryption key is not 256 bits
+var ErrInvalidEncryptionKey = errors.New("application: Encryption key must be 256 bits")
+
+// ErrOpenHMACKeyFailed - Gets returned by ClientSecret.OpenHMACKey when the sealed key cannot be decrypted with the encryption key
+var ErrOpenHMACKeyFailed = errors.New("application: Failed to decrypt HMAC key")
+
+/*
+ClientSecret - One of the secrets an application can authenticate with. Applications can hold several
+secrets at once, so that a new secret can be rolled out before the old one stops working
+*/
+type ClientSecret struct {
+	// ID - A UUID identifying the secret, so that it can be revoked without knowing its value
+	ID string `json:"id" bson:"id"`
+
+	// Credentials - The argon2id hash of the secret. The secret itself is never stored
+	Credentials *user.Credentials `json:"-" bson:"credentials"`
+
+	// CreatedAt - When the secret was generated
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+
+	// ExpiresAt - When the secret stops working. The secret never expires if this is the zero value
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+
+	// LastUsedAt - When the secret was last used to authenticate. The zero value if it has never been used
+	LastUsedAt time.Time `json:"last_used_at" bson:"last_used_at"`
+
+	// HMACKey - The secret encrypted with AES-256-GCM, so that it can verify client_secret_jwt assertions. Empty for other auth methods
+	HMACKey string `json:"-" bson:"hmac_key,omitempty"`
+}
+
+/*
+IsExpired - Returns true if the secret can no longer be used to authenticate
+*/
+func (secret *ClientSecret) IsExpired() bool {
+	return !secret.ExpiresAt.IsZero() && !time.Now().UTC().Before(secret.ExpiresAt)
+}
+
+/*
+SealHMACKey - Encrypt the secret passed in the raw parameter with the AES-256 key passed in the
+encryptionKey parameter, and store it as the HMACKey of the ClientSecret. The ID of the secret is
+authenticated with the ciphertext, so a sealed key cannot be moved onto another secret
+*/
+func (secret *ClientSecret) SealHMACKey(raw string, encryptionKey []byte) error {
+	aead, err := newHMACKeyCipher(encryptionKey)
+	if err != nil {
+		return err
+	}
+
+	nonce, err := rand.Seed(aead.NonceSize())
+	if err != nil {
+		return err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(raw), []byte(secret.ID))
+	secret.HMACKey = base64.RawURLEncoding.EncodeToString(sealed)
+
+	return nil
+}
+
+/*
+OpenHMACKey - Decrypt the HMACKey of the ClientSecret with the AES-256 key passed in the encryptionKey
+parameter. Returns nil without an error if the secret was never sealed
+*/
+func (secret *ClientSecret) OpenHMACKey(encryptionKey []byte) ([]byte, error) {
+	if secret.HMACKey == "" {
+		return nil, nil
+	}
+
+	aead, err := newHMACKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(secret.HMACKey)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrOpenHMACKeyFailed
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+
+	ret, err := aead.Open(nil, nonce, ciphertext, []byte(secret.ID))
+	if err != nil {
+		return nil, ErrOpenHMACKeyFailed
+	}
+
+	return ret, nil
+}
+
+/*
+newHMACKeyCipher - Build the AES-256-GCM cipher that HMAC keys are sealed with
+*/
+func newHMACKeyCipher(encryptionKey []byte) (cipher.AEAD, error) {
+	if len(encryptionKey) != 32 {
+		return nil, ErrInvalidEncryptionKey
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+/*
+AddClientSecret - Generate a new 256-bit secret for the application, hashed using the parameters
+passed in the params parameter. Existing secrets keep working. If lifetime is zero, the secret
+never expires. The secret is returned, and is the only time it is available
+*/
+func (application *Application) AddClientSecret(params *user.HashingParameters, lifetime time.Duration) (*ClientSecret, string, error) {
+	raw, err := rand.URLSafeString(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	credentials, err := user.NewCredentials(raw, params)
+	if err != nil {
+		return nil, "", err
+	}
+
+	identifier, err := uuid.NewV6()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now().UTC()
+
+	secret := &ClientSecret{
+		ID:          identifier.String(),
+		Credentials: credentials,
+		CreatedAt:   now,
+	}
+
+	if lifetime > 0 {
+		secret.ExpiresAt = now.Add(lifetime)
+	}
+
+	application.ClientSecrets = append(application.ClientSecrets, secret)
+
+	return secret, raw, nil
+}
+
+/*
+RotateClientSecret - Add a new secret to the application, and limit every existing secret to the grace
+period passed in the grace parameter. Clients have until the grace period ends to switch to the new
+secret, after which the old ones stop working. Secrets that already expire sooner are left untouched
+*/
+func (application *Application) RotateClientSecret(params *user.HashingParameters, lifetime time.Duration, grace time.Duration) (*ClientSecret, string, error) {
+	deadline := time.Now().UTC().Add(grace)
+
+	for _, existing := range application.ClientSecrets {
+		if existing.ExpiresAt.IsZero() || existing.ExpiresAt.After(deadline) {
+			existing.ExpiresAt = deadline
+		}
+	}
+
+	return application.AddClientSecret(params, lifetime)
+}
+
+/*
+RevokeClientSecret - Remove the secret with the ID passed in the secretId parameter, so that it can
+no longer be used to authenticate
+*/
+func (application *Application) RevokeClientSecret(secretId string) error {
+	index := slices.IndexFunc(application.ClientSecrets, func(secret *ClientSecret) bool {
+		return secret.ID == secretId
+	})
+
+	if index == -1 {
+		return ErrClientSecretDoesNotExist
+	}
+
+	application.ClientSecrets = slices.Delete(application.ClientSecrets, index, index+1)
+
+	return nil
+}
+
+/*
+HMACKeys - Decrypt the HMAC keys of every secret of the application that has been sealed and has not
+expired, using the AES-256 key passed in the encryptionKey parameter. Used to verify client_secret_jwt
+assertions
+*/
+func (application *Application) HMACKeys(encryptionKey []byte) ([][]byte, error) {
+	var ret [][]byte
+
+	for _, secret := range application.ClientSecrets {
+		if secret.IsExpired() {
+			continue
+		}
+
+		key, err := secret.OpenHMACKey(encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if key != nil {
+			ret = append(ret, key)
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+RemoveExpiredClientSecrets - Remove every secret that has expired from the application
+*/
+func (application *Application) RemoveExpiredClientSecrets() {
+	application.ClientSecrets = slices.DeleteFunc(application.ClientSecrets, func(secret *ClientSecret) bool {
+		return secret.IsExpired()
+	})
+}
+
+/*
+ExpiringClientSecrets - Returns the secrets of the application that are still valid, but expire
+within the duration passed in the within parameter
+*/
+func (application *Application) ExpiringClientSecrets(within time.Duration) []*ClientSecret {
+	var ret []*ClientSecret
+
+	deadline := time.Now().UTC().Add(within)
+
+	for _, secret := range application.ClientSecrets {
+		if !secret.ExpiresAt.IsZero() && !secret.IsExpired() && secret.ExpiresAt.Before(deadline) {
+			ret = append(ret, secret)
+		}
+	}
+
+	return ret
+}
+
+/*
+MatchClientSecret - Returns the secret of the application that matches the value passed in the secret
+parameter, or nil if none do. Expired secrets are never matched. Every secret is checked, even after a
+match is found, so that the time taken does not reveal which secret matched
+*/
+func (application *Application) MatchClientSecret(secret string) *ClientSecret {
+	var ret *ClientSecret
+
+	for _, candidate := range application.ClientSecrets {
+		if candidate.Credentials == nil || candidate.IsExpired() {
+			continue
+		}
+
+		ok, err := candidate.Credentials.ValidateCredential(secret)
+		if err == nil && ok && ret == nil {
+			ret = candidate
+		}
+	}
+
+	return ret
+}
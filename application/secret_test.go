@@ -0,0 +1,76 @@
+package application
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSealHMACKey(t *testing.T) {
+	encryptionKey := bytes.Repeat([]byte{1}, 32)
+	otherKey := bytes.Repeat([]byte{2}, 32)
+
+	secret := &ClientSecret{ID: "secret-1"}
+
+	err := secret.SealHMACKey("raw-secret", encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if secret.HMACKey == "" || bytes.Contains([]byte(secret.HMACKey), []byte("raw-secret")) {
+		t.Fatalf("expected the secret to be sealed, got %q", secret.HMACKey)
+	}
+
+	opened, err := secret.OpenHMACKey(encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(opened) != "raw-secret" {
+		t.Fatalf("expected the secret back, got %q", opened)
+	}
+
+	_, err = secret.OpenHMACKey(otherKey)
+	if !errors.Is(err, ErrOpenHMACKeyFailed) {
+		t.Fatalf("expected ErrOpenHMACKeyFailed with another key, got %v", err)
+	}
+
+	moved := &ClientSecret{ID: "secret-2", HMACKey: secret.HMACKey}
+
+	_, err = moved.OpenHMACKey(encryptionKey)
+	if !errors.Is(err, ErrOpenHMACKeyFailed) {
+		t.Fatalf("expected ErrOpenHMACKeyFailed for a key moved onto another secret, got %v", err)
+	}
+
+	err = secret.SealHMACKey("raw-secret", []byte("short"))
+	if !errors.Is(err, ErrInvalidEncryptionKey) {
+		t.Fatalf("expected ErrInvalidEncryptionKey, got %v", err)
+	}
+}
+
+func TestHMACKeys(t *testing.T) {
+	encryptionKey := bytes.Repeat([]byte{1}, 32)
+
+	active := &ClientSecret{ID: "active"}
+	expired := &ClientSecret{ID: "expired", ExpiresAt: time.Now().Add(-time.Hour)}
+	unsealed := &ClientSecret{ID: "unsealed"}
+
+	for _, secret := range []*ClientSecret{active, expired} {
+		err := secret.SealHMACKey(secret.ID, encryptionKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app := &Application{ClientSecrets: []*ClientSecret{active, expired, unsealed}}
+
+	keys, err := app.HMACKeys(encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || string(keys[0]) != "active" {
+		t.Fatalf("expected only the active sealed secret, got %q", keys)
+	}
+}
@@ -0,0 +1,115 @@
+package application
+
+import (
+	"fmt"
+	"slices"
+)
+
+type Type string
+
+const (
+	// SinglePageApplication - A browser based application. It is a public client that cannot keep a secret
+	SinglePageApplication Type = "spa"
+
+	// NativeApplication - A desktop or mobile application. It is a public client that cannot keep a secret
+	NativeApplication Type = "native"
+
+	// RegularWebApplication - A server side web application. It is a confidential client that signs users in
+	RegularWebApplication Type = "regular_web"
+
+	// MachineToMachine - A service that authenticates as itself. It is a confidential client with no users
+	MachineToMachine Type = "m2m"
+)
+
+// Types - Every application type that simple-idp supports
+var Types = []Type{SinglePageApplication, NativeApplication, RegularWebApplication, MachineToMachine}
+
+/*
+IsPublic - Returns true if applications of this type are public clients that cannot keep a secret
+*/
+func (clientType Type) IsPublic() bool {
+	return clientType == SinglePageApplication || clientType == NativeApplication
+}
+
+/*
+GrantTypes - Returns the grant types that applications of this type are allowed to use
+*/
+func (clientType Type) GrantTypes() []GrantType {
+	switch clientType {
+	case SinglePageApplication:
+		return []GrantType{AuthorizationCodePKCE, RefreshToken}
+	case NativeApplication:
+		return []GrantType{AuthorizationCodePKCE, RefreshToken, DeviceCode}
+	case RegularWebApplication:
+		return []GrantType{AuthorizationCodePKCE, RefreshToken, ClientCredentials, TokenExchange}
+	case MachineToMachine:
+		return []GrantType{ClientCredentials}
+	}
+
+	return nil
+}
+
+/*
+DefaultGrantTypes - Returns the grant types an application of this type is given if none are requested
+*/
+func (clientType Type) DefaultGrantTypes() []GrantType {
+	if clientType == MachineToMachine {
+		return []GrantType{ClientCredentials}
+	}
+
+	return []GrantType{AuthorizationCodePKCE, RefreshToken}
+}
+
+/*
+DefaultAuthMethod - Returns the TokenEndpointAuthMethod an application of this type is given by default.
+Public clients cannot authenticate, and must use PKCE instead
+*/
+func (clientType Type) DefaultAuthMethod() AuthMethod {
+	if clientType.IsPublic() {
+		return None
+	}
+
+	return ClientSecretBasic
+}
+
+/*
+InferType - Determine the type of an application from the grant types and auth method it requests.
+Used when an application is registered without a type. Public clients are treated as native
+applications, and confidential clients that only use client_credentials as machine to machine
+*/
+func InferType(grantType []GrantType, method AuthMethod) Type {
+	switch {
+	case method == None:
+		return NativeApplication
+	case len(grantType) != 0 && !slices.ContainsFunc(grantType, func(value GrantType) bool { return value != ClientCredentials }):
+		return MachineToMachine
+	}
+
+	return RegularWebApplication
+}
+
+/*
+validateType - Ensure that the grant types and auth method of the application are allowed for its type
+*/
+func (application *Application) validateType() error {
+	if !slices.Contains(Types, application.Type) {
+		return fmt.Errorf("%w: unsupported application type %q", ErrInvalidMetadata, application.Type)
+	}
+
+	allowed := application.Type.GrantTypes()
+	for _, grantType := range application.GrantType {
+		if !slices.Contains(allowed, grantType) {
+			return fmt.Errorf("%w: %s applications cannot use the %s grant", ErrInvalidMetadata, application.Type, grantType)
+		}
+	}
+
+	if application.Type.IsPublic() != application.IsPublic() {
+		if application.Type.IsPublic() {
+			return fmt.Errorf("%w: %s applications are public clients and must use the none auth method", ErrInvalidMetadata, application.Type)
+		}
+
+		return fmt.Errorf("%w: %s applications are confidential clients and cannot use the none auth method", ErrInvalidMetadata, application.Type)
+	}
+
+	return nil
+}
@@ -0,0 +1,82 @@
+package application
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateType(t *testing.T) {
+	tests := []struct {
+		name        string
+		application *Application
+		wantErr     bool
+	}{
+		{
+			name:        "spa",
+			application: &Application{Type: SinglePageApplication, TokenEndpointAuthMethod: None, GrantType: []GrantType{AuthorizationCodePKCE, RefreshToken}},
+		},
+		{
+			name:        "native with device code",
+			application: &Application{Type: NativeApplication, TokenEndpointAuthMethod: None, GrantType: []GrantType{DeviceCode}},
+		},
+		{
+			name:        "regular web",
+			application: &Application{Type: RegularWebApplication, TokenEndpointAuthMethod: ClientSecretBasic, GrantType: []GrantType{AuthorizationCodePKCE, ClientCredentials, TokenExchange}},
+		},
+		{
+			name:        "m2m",
+			application: &Application{Type: MachineToMachine, TokenEndpointAuthMethod: PrivateKeyJWT, GrantType: []GrantType{ClientCredentials}},
+		},
+		{
+			name:        "unknown type",
+			application: &Application{Type: "desktop", TokenEndpointAuthMethod: None},
+			wantErr:     true,
+		},
+		{
+			name:        "spa with client credentials",
+			application: &Application{Type: SinglePageApplication, TokenEndpointAuthMethod: None, GrantType: []GrantType{ClientCredentials}},
+			wantErr:     true,
+		},
+		{
+			name:        "spa with device code",
+			application: &Application{Type: SinglePageApplication, TokenEndpointAuthMethod: None, GrantType: []GrantType{DeviceCode}},
+			wantErr:     true,
+		},
+		{
+			name:        "m2m with authorization code",
+			application: &Application{Type: MachineToMachine, TokenEndpointAuthMethod: ClientSecretBasic, GrantType: []GrantType{AuthorizationCodePKCE}},
+			wantErr:     true,
+		},
+		{
+			name:        "m2m with refresh token",
+			application: &Application{Type: MachineToMachine, TokenEndpointAuthMethod: ClientSecretBasic, GrantType: []GrantType{RefreshToken}},
+			wantErr:     true,
+		},
+		{
+			name:        "public type with client secret",
+			application: &Application{Type: NativeApplication, TokenEndpointAuthMethod: ClientSecretBasic},
+			wantErr:     true,
+		},
+		{
+			name:        "confidential type without authentication",
+			application: &Application{Type: RegularWebApplication, TokenEndpointAuthMethod: None},
+			wantErr:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.application.validateType()
+			if test.wantErr {
+				if !errors.Is(err, ErrInvalidMetadata) {
+					t.Fatalf("expected ErrInvalidMetadata, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
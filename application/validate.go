@@ -0,0 +1,143 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+)
+
+// ErrInvalidRedirectURI - Gets returned by Application.Validate when one of the RedirectURIs is not acceptable
+var ErrInvalidRedirectURI = errors.New("application: Invalid redirect URI")
+
+// ErrInvalidMetadata - Gets returned by Application.Validate when the application is configured in a way that cannot be used
+var ErrInvalidMetadata = errors.New("application: Invalid client metadata")
+
+/*
+Validate - Validate the client metadata of the application, so that an application registered by
+an untrusted party cannot end up in a state the authorization server does not support. The errors
+returned wrap either ErrInvalidRedirectURI or ErrInvalidMetadata, and describe what was rejected
+*/
+func (application *Application) Validate() error {
+	if len(application.GrantType) == 0 {
+		return fmt.Errorf("%w: at least one grant type is required", ErrInvalidMetadata)
+	}
+
+	for _, grantType := range application.GrantType {
+		if !slices.Contains(GrantTypes, grantType) {
+			return fmt.Errorf("%w: unsupported grant type %q", ErrInvalidMetadata, grantType)
+		}
+	}
+
+	if !slices.Contains(AuthMethods, application.TokenEndpointAuthMethod) {
+		return fmt.Errorf("%w: unsupported token endpoint auth method %q", ErrInvalidMetadata, application.TokenEndpointAuthMethod)
+	}
+
+	err := application.validateType()
+	if err != nil {
+		return err
+	}
+
+	err = application.validateRedirectURIs()
+	if err != nil {
+		return err
+	}
+
+	err = application.validateKeys()
+	if err != nil {
+		return err
+	}
+
+	return application.validateCertificate()
+}
+
+/*
+validateRedirectURIs - Ensure that every redirect URI, post logout redirect URI and origin registered with
+the application is acceptable. Applications using the authorization code grant must register at least
+one redirect URI
+*/
+func (application *Application) validateRedirectURIs() error {
+	if application.HasGrantType(AuthorizationCodePKCE) && len(application.RedirectURIs) == 0 {
+		return fmt.Errorf("%w: at least one redirect URI is required for the authorization_code grant", ErrInvalidRedirectURI)
+	}
+
+	for _, redirectUri := range slices.Concat(application.RedirectURIs, application.PostLogoutRedirectURIs) {
+		err := validateRedirectURI(redirectUri, application.AllowWildcardSubdomains)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, origin := range application.AllowedOrigins {
+		err := validateOrigin(origin, application.AllowWildcardSubdomains)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+validateKeys - Ensure that the JWKS and JWKSURI are not both set, that every inline key can be
+decoded, and that applications authenticating with a key have registered one
+*/
+func (application *Application) validateKeys() error {
+	hasJWKS := application.JWKS != nil && len(application.JWKS.Keys) != 0
+
+	if hasJWKS && application.JWKSURI != "" {
+		return fmt.Errorf("%w: jwks and jwks_uri cannot be used together", ErrInvalidMetadata)
+	}
+
+	if hasJWKS {
+		for _, jwk := range application.JWKS.Keys {
+			_, err := jwk.PublicKey()
+			if err != nil {
+				return fmt.Errorf("%w: jwks contains an invalid key (%s)", ErrInvalidMetadata, err)
+			}
+		}
+	}
+
+	if application.JWKSURI != "" {
+		parsed, err := url.Parse(application.JWKSURI)
+		if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			return fmt.Errorf("%w: jwks_uri must be an absolute https URL", ErrInvalidMetadata)
+		}
+	}
+
+	method := application.TokenEndpointAuthMethod
+	if (method == PrivateKeyJWT || method == SelfSignedTLSClientAuth) && !hasJWKS && application.JWKSURI == "" {
+		return fmt.Errorf("%w: %s requires jwks or jwks_uri", ErrInvalidMetadata, method)
+	}
+
+	return nil
+}
+
+/*
+validateCertificate - Ensure that applications using tls_client_auth register exactly one of the
+subject DN or SAN values their certificate is matched against, as required by RFC 8705 Section 2.1.2
+*/
+func (application *Application) validateCertificate() error {
+	if application.TokenEndpointAuthMethod != TLSClientAuth {
+		return nil
+	}
+
+	count := 0
+	for _, value := range []string{
+		application.TLSClientAuthSubjectDN,
+		application.TLSClientAuthSANDNS,
+		application.TLSClientAuthSANURI,
+		application.TLSClientAuthSANIP,
+		application.TLSClientAuthSANEmail,
+	} {
+		if value != "" {
+			count++
+		}
+	}
+
+	if count != 1 {
+		return fmt.Errorf("%w: tls_client_auth requires exactly one subject DN or SAN value", ErrInvalidMetadata)
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package grant
+
+import (
+	"errors"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"slices"
+)
+
+// ErrScopeNotPermitted - Gets returned when a grant is given a scope that is not one of the permissions of its API
+var ErrScopeNotPermitted = errors.New("grant: Scope is not a permission of the API")
+
+/*
+Grant - Authorizes an application to request tokens for an API using the client_credentials grant.
+The tokens can only contain the scopes listed in the grant
+*/
+type Grant struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// ApplicationID - The Metadata.Id of the application the grant was given to
+	ApplicationID string `json:"application_id" bson:"application_id"`
+
+	// APIID - The Metadata.Id of the API the application may request tokens for
+	APIID string `json:"api_id" bson:"api_id"`
+
+	// Scope - The names of the permissions of the API that the application may request
+	Scope []string `json:"scope" bson:"scope"`
+}
+
+/*
+New - A constructor for the Grant structure. Every scope passed in the scopes parameter must be one
+of the permissions of the API, otherwise ErrScopeNotPermitted is returned
+*/
+func New(app *application.Application, target *api.API, scopes []string) (*Grant, error) {
+	meta, err := metadata.New()
+	if err != nil {
+		return nil, err
+	}
+
+	grant := &Grant{
+		Metadata:      meta,
+		ApplicationID: app.Metadata.Id,
+		APIID:         target.Metadata.Id,
+	}
+
+	err = grant.SetScope(target, scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	return grant, nil
+}
+
+/*
+SetScope - Replace the scopes of the grant. Every scope passed in the scopes parameter must be one of
+the permissions of the API the grant is for, otherwise ErrScopeNotPermitted is returned
+*/
+func (grant *Grant) SetScope(target *api.API, scopes []string) error {
+	for _, name := range scopes {
+		if !target.HasPermission(name) {
+			return ErrScopeNotPermitted
+		}
+	}
+
+	grant.Scope = slices.Compact(slices.Sorted(slices.Values(scopes)))
+
+	return nil
+}
+
+/*
+FilterScope - Returns the names of the scopes passed in the requested parameter that the grant
+allows, and that are still permissions of the API. Scopes that are not allowed are dropped
+*/
+func (grant *Grant) FilterScope(target *api.API, requested []string) []string {
+	var ret []string
+
+	for _, name := range requested {
+		if slices.Contains(grant.Scope, name) && target.HasPermission(name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret
+}
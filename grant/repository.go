@@ -0,0 +1,222 @@
+package grant
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrGrantAlreadyExists - Gets returned by CreateGrant when the application has already been granted access to the API
+var ErrGrantAlreadyExists = errors.New("grant: Already exists")
+
+// ErrGrantDoesNotExist - Gets returned by GetGrant, GetGrantByID, ReplaceGrant and RevokeGrant when a grant does not exist
+var ErrGrantDoesNotExist = errors.New("grant: Does not exist")
+
+// ErrFetchGrantFailed - Serves as a wrapper around database errors for the GetGrant, GetGrantByID and ListGrants functions
+var ErrFetchGrantFailed = errors.New("grant: Failed to fetch grant")
+
+// ErrCreateGrantFailed - Serves as a wrapper around database errors for the CreateGrant function
+var ErrCreateGrantFailed = errors.New("grant: Failed to create grant")
+
+// ErrReplaceGrantFailed - Serves as a wrapper around database errors for the ReplaceGrant function
+var ErrReplaceGrantFailed = errors.New("grant: Failed to replace grant")
+
+// ErrRevokeGrantFailed - Serves as a wrapper around database errors for the RevokeGrant, DeleteGrantsByApplication and DeleteGrantsByAPI functions
+var ErrRevokeGrantFailed = errors.New("grant: Failed to revoke grant")
+
+/*
+GetGrant - Fetch the grant that allows the application identified by applicationId to request tokens
+for the API identified by apiId. Both are Metadata.Id values
+*/
+func GetGrant(database *server.Database, applicationId string, apiId string) (*Grant, error) {
+	var ret Grant
+
+	err := database.Find("client_grant", bson.M{"application_id": applicationId, "api_id": apiId}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrGrantDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchGrantFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+GetGrantByID - Fetch a grant using its Metadata.Id
+*/
+func GetGrantByID(database *server.Database, id string) (*Grant, error) {
+	var ret Grant
+
+	err := database.Find("client_grant", bson.M{"metadata.id": id}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrGrantDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchGrantFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+ListGrants - Fetch every grant given to an application, using its Metadata.Id. If applicationId is
+empty, every grant stored in the database is returned
+*/
+func ListGrants(database *server.Database, applicationId string) ([]*Grant, error) {
+	var ret []*Grant
+
+	query := bson.M{}
+	if applicationId != "" {
+		query["application_id"] = applicationId
+	}
+
+	err := database.FindMany("client_grant", query, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchGrantFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+CheckGrantExists - Check to see if the application has already been granted access to the API
+*/
+func CheckGrantExists(database *server.Database, applicationId string, apiId string) (bool, error) {
+	ok, err := database.Exists("client_grant", bson.M{"application_id": applicationId, "api_id": apiId})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateGrant - Insert a new grant into the database, and return any errors that may occur. An application
+can only hold one grant per API
+*/
+func CreateGrant(database *server.Database, grant *Grant) error {
+	ok, err := CheckGrantExists(database, grant.ApplicationID, grant.APIID)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateGrantFailed, err)
+	}
+
+	if ok {
+		return ErrGrantAlreadyExists
+	}
+
+	err = database.Insert("client_grant", grant)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateGrantFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceGrant - Replace a grant with the model passed in the grant parameter. The Metadata.Id of the
+model is used to signify which grant to replace. Used to change the scopes of a grant
+*/
+func ReplaceGrant(database *server.Database, grant *Grant) error {
+	ok, err := database.Exists("client_grant", bson.M{"metadata.id": grant.Metadata.Id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceGrantFailed, err)
+	}
+
+	if !ok {
+		return ErrGrantDoesNotExist
+	}
+
+	err = database.Replace("client_grant", bson.M{"metadata.id": grant.Metadata.Id}, grant)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceGrantFailed, err)
+	}
+
+	return nil
+}
+
+/*
+RevokeGrant - Remove a single grant from the database using its Metadata.Id. Tokens that were already
+issued under the grant remain valid until they expire
+*/
+func RevokeGrant(database *server.Database, id string) error {
+	ok, err := database.Exists("client_grant", bson.M{"metadata.id": id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeGrantFailed, err)
+	}
+
+	if !ok {
+		return ErrGrantDoesNotExist
+	}
+
+	err = database.Delete("client_grant", bson.M{"metadata.id": id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeGrantFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteGrantsByApplication - Remove every grant given to an application, using its Metadata.Id
+*/
+func DeleteGrantsByApplication(database *server.Database, applicationId string) error {
+	err := database.DeleteMany("client_grant", bson.M{"application_id": applicationId})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeGrantFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteGrantsByAPI - Remove every grant for an API, using its Metadata.Id
+*/
+func DeleteGrantsByAPI(database *server.Database, apiId string) error {
+	err := database.DeleteMany("client_grant", bson.M{"api_id": apiId})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeGrantFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteApplication - Remove an application and every grant given to it, using its ClientID. The
+grants are removed first, so a failure can never leave grants behind for a later application
+*/
+func DeleteApplication(database *server.Database, clientId string) error {
+	app, err := application.GetApplicationByClientID(database, clientId)
+	if err != nil {
+		return err
+	}
+
+	err = DeleteGrantsByApplication(database, app.Metadata.Id)
+	if err != nil {
+		return err
+	}
+
+	return application.DeleteApplication(database, clientId)
+}
+
+/*
+DeleteAPI - Remove an API and every grant for it, using its audience. The grants are removed
+first, so a failure can never leave grants behind for an API recreated with the same ID
+*/
+func DeleteAPI(database *server.Database, audience string) error {
+	target, err := api.GetAPIByAudience(database, audience)
+	if err != nil {
+		return err
+	}
+
+	err = DeleteGrantsByAPI(database, target.Metadata.Id)
+	if err != nil {
+		return err
+	}
+
+	return api.DeleteAPI(database, audience)
+}
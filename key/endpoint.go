@@ -0,0 +1,26 @@
+package key
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+	"net/http"
+)
+
+/*
+JWKSEndpoint - A server.HandlerFunc that serves the public keys stored in the database
+as a JWK Set. Should be registered under /.well-known/jwks.json
+*/
+func JWKSEndpoint(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		set, err := GetJWKSet(service.Database())
+		if err != nil {
+			slog.Error("Failed to build JWK Set", "err", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, set)
+	}
+}
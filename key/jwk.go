@@ -0,0 +1,256 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// ErrUnsupportedKeyType - Gets returned when a public key cannot be represented as a JSON Web Key
+var ErrUnsupportedKeyType = errors.New("key: Key type is not supported")
+
+// ErrInvalidJWK - Gets returned by JWK.PublicKey when the members of a JWK cannot be decoded
+var ErrInvalidJWK = errors.New("key: JWK is invalid")
+
+/*
+JWK - The RFC 7517 representation of a public key. Only the members required
+for RSA, EC (P-256) and OKP (Ed25519) keys are supported
+*/
+type JWK struct {
+	// KeyType - The family of the key. Either RSA, EC or OKP
+	KeyType string `json:"kty" bson:"kty"`
+
+	// Use - The intended use of the key. Always sig for keys generated by simple-idp
+	Use string `json:"use,omitempty" bson:"use,omitempty"`
+
+	// KeyID - The identifier of the key. Matches the kid header of the tokens it signed
+	KeyID string `json:"kid,omitempty" bson:"kid,omitempty"`
+
+	// Algorithm - The algorithm the key is used with
+	Algorithm string `json:"alg,omitempty" bson:"alg,omitempty"`
+
+	// N - The modulus of an RSA key
+	N string `json:"n,omitempty" bson:"n,omitempty"`
+
+	// E - The exponent of an RSA key
+	E string `json:"e,omitempty" bson:"e,omitempty"`
+
+	// Curve - The curve of an EC or OKP key
+	Curve string `json:"crv,omitempty" bson:"crv,omitempty"`
+
+	// X - The x coordinate of an EC key, or the public key of an OKP key
+	X string `json:"x,omitempty" bson:"x,omitempty"`
+
+	// Y - The y coordinate of an EC key
+	Y string `json:"y,omitempty" bson:"y,omitempty"`
+
+	// X5C - The certificate chain of the key, each certificate base64 (not base64url) encoded DER
+	X5C []string `json:"x5c,omitempty" bson:"x5c,omitempty"`
+}
+
+/*
+JWKSet - A RFC 7517 JSON Web Key Set. This is what gets served to resource servers, and
+what applications register to have their own signatures verified
+*/
+type JWKSet struct {
+	// Keys - The public keys that can be used for verifying tokens
+	Keys []*JWK `json:"keys" bson:"keys"`
+}
+
+/*
+NewJWK - A constructor for the JWK structure. Converts a public key into its JSON Web
+Key representation
+*/
+func NewJWK(public crypto.PublicKey) (*JWK, error) {
+	switch public := public.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			KeyType: "RSA",
+			N:       base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+			E:       base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		if public.Curve.Params().Name != "P-256" {
+			return nil, ErrUnsupportedKeyType
+		}
+
+		/*
+			Coordinates need to be padded to the size of the curve, otherwise
+			keys with a leading zero byte produce a different thumbprint
+		*/
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		public.X.FillBytes(x)
+		public.Y.FillBytes(y)
+
+		return &JWK{
+			KeyType: "EC",
+			Curve:   "P-256",
+			X:       base64.RawURLEncoding.EncodeToString(x),
+			Y:       base64.RawURLEncoding.EncodeToString(y),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			KeyType: "OKP",
+			Curve:   "Ed25519",
+			X:       base64.RawURLEncoding.EncodeToString(public),
+		}, nil
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+/*
+NewJWKSet - A constructor for the JWKSet structure. Converts each key passed in the
+keys parameter into its JSON Web Key representation
+*/
+func NewJWKSet(keys []*Key) (*JWKSet, error) {
+	set := &JWKSet{Keys: []*JWK{}}
+
+	for _, key := range keys {
+		jwk, err := key.JWK()
+		if err != nil {
+			return nil, err
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set, nil
+}
+
+/*
+Thumbprint - Computes the RFC 7638 SHA-256 thumbprint of the JWK. The required members
+are serialized in lexicographic order as the RFC dictates
+*/
+func (jwk *JWK) Thumbprint() (string, error) {
+	var members interface{}
+
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e" bson:"e"`
+			Kty string `json:"kty" bson:"kty"`
+			N   string `json:"n" bson:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv" bson:"crv"`
+			Kty string `json:"kty" bson:"kty"`
+			X   string `json:"x" bson:"x"`
+			Y   string `json:"y" bson:"y"`
+		}{jwk.Curve, jwk.KeyType, jwk.X, jwk.Y}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv" bson:"crv"`
+			Kty string `json:"kty" bson:"kty"`
+			X   string `json:"x" bson:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	default:
+		return "", ErrUnsupportedKeyType
+	}
+
+	encoded, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(encoded)
+
+	return base64.RawURLEncoding.EncodeToString(digest[:]), nil
+}
+
+/*
+PublicKey - Converts the JWK back into the public key it represents. This is the inverse of NewJWK
+*/
+func (jwk *JWK) PublicKey() (crypto.PublicKey, error) {
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, ErrInvalidJWK
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, ErrInvalidJWK
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if jwk.Curve != "P-256" {
+			return nil, ErrUnsupportedKeyType
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != 32 {
+			return nil, ErrInvalidJWK
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if err != nil || len(y) != 32 {
+			return nil, ErrInvalidJWK
+		}
+
+		/*
+			The point is run through the uncompressed encoding so that the
+			crypto/ecdh package rejects points that are not on the curve
+		*/
+		encoded := append([]byte{4}, append(x, y...)...)
+		if _, err := ecdh.P256().NewPublicKey(encoded); err != nil {
+			return nil, ErrInvalidJWK
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return nil, ErrUnsupportedKeyType
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, ErrUnsupportedKeyType
+}
+
+/*
+Find - Returns the JWK whose KeyID matches the kid parameter. If kid is empty, a key is only
+returned when the set contains exactly one, as there would be no way to choose between them
+*/
+func (set *JWKSet) Find(kid string) *JWK {
+	if kid == "" {
+		if len(set.Keys) == 1 {
+			return set.Keys[0]
+		}
+
+		return nil
+	}
+
+	for _, jwk := range set.Keys {
+		if jwk.KeyID == kid {
+			return jwk
+		}
+	}
+
+	return nil
+}
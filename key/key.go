@@ -0,0 +1,208 @@
+package key
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+)
+
+// ErrUnsupportedAlgorithm - Gets returned when a key is requested for an algorithm that cannot be used for asymmetric signing
+var ErrUnsupportedAlgorithm = errors.New("key: Algorithm is not supported")
+
+// rsaKeySize - The modulus size, in bits, used when generating RSA keys
+const rsaKeySize = 2048
+
+type Status string
+
+const (
+	// StatusNext - The key is published in the JWK Set but is not used for signing yet
+	StatusNext Status = "next"
+
+	// StatusActive - The key is used for signing new tokens
+	StatusActive Status = "active"
+
+	// StatusRetired - The key is no longer used for signing, but is kept until every token it signed has expired
+	StatusRetired Status = "retired"
+
+	// StatusRevoked - The key has been compromised and tokens signed with it are no longer accepted
+	StatusRevoked Status = "revoked"
+)
+
+/*
+Key - An asymmetric key pair that is used for signing tokens. The public half of each
+key is published in the JWK Set so that resource servers can verify tokens without
+needing to share a secret with simple-idp
+*/
+type Key struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// KeyID - The RFC 7638 thumbprint of the public key. Sent in the kid header of each token
+	KeyID string `json:"kid" bson:"kid"`
+
+	// Algorithm - The signing algorithm that this key is used for
+	Algorithm api.TokenType `json:"alg" bson:"alg"`
+
+	// PrivateKey - The base64 encoded PKCS #8 representation of the private key. This is never
+	// serialized to JSON so that it cannot be leaked through the API
+	PrivateKey string `json:"-" bson:"private_key"`
+
+	// PublicKey - The base64 encoded PKIX representation of the public key
+	PublicKey string `json:"public_key" bson:"public_key"`
+
+	// Status - Where the key currently is in its rotation lifecycle
+	Status Status `json:"status" bson:"status"`
+
+	// ActivatesAt - The date that a next key is scheduled to become active
+	ActivatesAt int64 `json:"activates_at" bson:"activates_at"`
+
+	// RetiredAt - The date that the key stopped being used for signing
+	RetiredAt int64 `json:"retired_at" bson:"retired_at"`
+
+	// ExpiresAt - The date that every token signed by a retired key has expired. The key is removed after this
+	ExpiresAt int64 `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+New - A constructor for the Key structure. Generates a new key pair for the algorithm
+passed in the algorithm parameter. New keys always start with the StatusNext status
+*/
+func New(algorithm api.TokenType) (*Key, error) {
+	var signer crypto.Signer
+	var err error
+
+	switch algorithm {
+	case api.RS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case api.ES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case api.EdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, ErrUnsupportedAlgorithm
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := NewJWK(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	keyId, err := jwk.Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+
+	meta, err := metadata.New()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Key{
+		Metadata:   meta,
+		KeyID:      keyId,
+		Algorithm:  algorithm,
+		PrivateKey: base64.URLEncoding.EncodeToString(privateKey),
+		PublicKey:  base64.URLEncoding.EncodeToString(publicKey),
+		Status:     StatusNext,
+	}, nil
+}
+
+/*
+CanVerify - Returns true if tokens signed by this key should still be accepted
+*/
+func (key *Key) CanVerify() bool {
+	return key.Status == StatusActive || key.Status == StatusRetired
+}
+
+/*
+Signer - Decodes the private key so that it can be used for signing tokens
+*/
+func (key *Key) Signer() (crypto.Signer, error) {
+	decoded, err := base64.URLEncoding.DecodeString(key.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, ErrUnsupportedAlgorithm
+	}
+
+	return signer, nil
+}
+
+/*
+Public - Decodes the public key so that it can be used for verifying tokens
+*/
+func (key *Key) Public() (crypto.PublicKey, error) {
+	decoded, err := base64.URLEncoding.DecodeString(key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return x509.ParsePKIXPublicKey(decoded)
+}
+
+/*
+SigningMethod - Returns the jwt.SigningMethod that corresponds to the algorithm of the key
+*/
+func (key *Key) SigningMethod() (jwt.SigningMethod, error) {
+	switch key.Algorithm {
+	case api.RS256:
+		return jwt.SigningMethodRS256, nil
+	case api.ES256:
+		return jwt.SigningMethodES256, nil
+	case api.EdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, ErrUnsupportedAlgorithm
+}
+
+/*
+JWK - Converts the public half of the key into a JSON Web Key
+*/
+func (key *Key) JWK() (*JWK, error) {
+	public, err := key.Public()
+	if err != nil {
+		return nil, err
+	}
+
+	jwk, err := NewJWK(public)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk.KeyID = key.KeyID
+	jwk.Algorithm = string(key.Algorithm)
+	jwk.Use = "sig"
+
+	return jwk, nil
+}
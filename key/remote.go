@@ -0,0 +1,122 @@
+package key
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrFetchJWKSetFailed - Gets returned by FetchJWKSet when a remote JWK Set cannot be downloaded or decoded
+var ErrFetchJWKSetFailed = errors.New("key: Failed to fetch JWK Set")
+
+// remoteJWKSetLifetime - How long a remote JWK Set is cached before it is downloaded again
+const remoteJWKSetLifetime = 5 * time.Minute
+
+// remoteJWKSetMinRefresh - How long a remote JWK Set is kept before a refresh is allowed to bypass the cache
+const remoteJWKSetMinRefresh = 30 * time.Second
+
+// remoteJWKSetMaxSize - The largest JWK Set, in bytes, that will be downloaded
+const remoteJWKSetMaxSize = 1 << 20
+
+// remoteJWKSetMaxEntries - The most remote JWK Sets that are cached at once
+const remoteJWKSetMaxEntries = 256
+
+// remoteClient - The HTTP client used to download remote JWK Sets
+var remoteClient = &http.Client{Timeout: 5 * time.Second}
+
+/*
+remoteJWKSet - A JWK Set that was downloaded from a URI, and when it was downloaded
+*/
+type remoteJWKSet struct {
+	set       *JWKSet
+	fetchedAt time.Time
+}
+
+// remoteJWKSets - Caches remote JWK Sets by URI so that each signature does not require a download
+var remoteJWKSets = map[string]*remoteJWKSet{}
+
+// remoteJWKSetsLock - Guards remoteJWKSets
+var remoteJWKSetsLock sync.Mutex
+
+/*
+FetchJWKSet - Download the JWK Set served at the URI passed in the uri parameter. Only https URIs
+are fetched. Results are cached for 5 minutes. If refresh is true the cache is bypassed, which should
+be done when a kid cannot be found in the cached set, as the owner of the set may have rotated their
+keys. To avoid downloading the set on every request, a refresh is only performed if the cached set is
+older than 30 seconds
+*/
+func FetchJWKSet(uri string, refresh bool) (*JWKSet, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: (%q is not an absolute https URL)", ErrFetchJWKSetFailed, uri)
+	}
+
+	remoteJWKSetsLock.Lock()
+	cached, ok := remoteJWKSets[uri]
+	remoteJWKSetsLock.Unlock()
+
+	if ok {
+		age := time.Since(cached.fetchedAt)
+		if age < remoteJWKSetMinRefresh || (!refresh && age < remoteJWKSetLifetime) {
+			return cached.set, nil
+		}
+	}
+
+	resp, err := remoteClient.Get(uri)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchJWKSetFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: (unexpected status %d)", ErrFetchJWKSetFailed, resp.StatusCode)
+	}
+
+	var set JWKSet
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, remoteJWKSetMaxSize)).Decode(&set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchJWKSetFailed, err)
+	}
+
+	storeJWKSet(uri, &set)
+
+	return &set, nil
+}
+
+/*
+storeJWKSet - Add a downloaded JWK Set to the cache. Sets that have outlived remoteJWKSetLifetime
+are removed first, and if the cache is still full the oldest set is evicted, so that registering
+many JWKSURIs cannot grow the cache without bound
+*/
+func storeJWKSet(uri string, set *JWKSet) {
+	remoteJWKSetsLock.Lock()
+	defer remoteJWKSetsLock.Unlock()
+
+	now := time.Now()
+
+	if _, ok := remoteJWKSets[uri]; !ok && len(remoteJWKSets) >= remoteJWKSetMaxEntries {
+		oldest := ""
+		for cachedUri, cached := range remoteJWKSets {
+			if now.Sub(cached.fetchedAt) >= remoteJWKSetLifetime {
+				delete(remoteJWKSets, cachedUri)
+				continue
+			}
+
+			if oldest == "" || cached.fetchedAt.Before(remoteJWKSets[oldest].fetchedAt) {
+				oldest = cachedUri
+			}
+		}
+
+		if len(remoteJWKSets) >= remoteJWKSetMaxEntries {
+			delete(remoteJWKSets, oldest)
+		}
+	}
+
+	remoteJWKSets[uri] = &remoteJWKSet{set: set, fetchedAt: now}
+}
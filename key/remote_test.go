@@ -0,0 +1,199 @@
+package key
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+/*
+newJWKSServer - Start a TLS server that serves a JWK Set containing a single P-256 key under /jwks,
+and counts how many times it was downloaded. The package HTTP client is pointed at the server and
+the cache is emptied for the duration of the test
+*/
+func newJWKSServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := NewJWK(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.KeyID = "k1"
+
+	var downloads atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		_ = json.NewEncoder(w).Encode(&JWKSet{Keys: []*JWK{jwk}})
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/invalid", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("not json"))
+	})
+
+	server := httptest.NewTLSServer(mux)
+	t.Cleanup(server.Close)
+
+	client := remoteClient
+	remoteClient = server.Client()
+	t.Cleanup(func() { remoteClient = client })
+
+	resetJWKSetCache(t)
+
+	return server, &downloads
+}
+
+/*
+resetJWKSetCache - Empty the remote JWK Set cache, and empty it again once the test finishes
+*/
+func resetJWKSetCache(t *testing.T) {
+	t.Helper()
+
+	remoteJWKSetsLock.Lock()
+	remoteJWKSets = map[string]*remoteJWKSet{}
+	remoteJWKSetsLock.Unlock()
+
+	t.Cleanup(func() {
+		remoteJWKSetsLock.Lock()
+		remoteJWKSets = map[string]*remoteJWKSet{}
+		remoteJWKSetsLock.Unlock()
+	})
+}
+
+func TestFetchJWKSet(t *testing.T) {
+	server, _ := newJWKSServer(t)
+
+	tests := []struct {
+		name    string
+		uri     string
+		wantErr bool
+	}{
+		{name: "https", uri: server.URL + "/jwks"},
+		{name: "plain http", uri: "http" + server.URL[len("https"):] + "/jwks", wantErr: true},
+		{name: "relative", uri: "/jwks", wantErr: true},
+		{name: "not found", uri: server.URL + "/missing", wantErr: true},
+		{name: "invalid body", uri: server.URL + "/invalid", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			set, err := FetchJWKSet(test.uri, false)
+			if test.wantErr {
+				if !errors.Is(err, ErrFetchJWKSetFailed) {
+					t.Fatalf("expected ErrFetchJWKSetFailed, got %v", err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if set.Find("k1") == nil {
+				t.Fatal("expected the set to contain k1")
+			}
+		})
+	}
+}
+
+func TestFetchJWKSetCache(t *testing.T) {
+	server, downloads := newJWKSServer(t)
+	uri := server.URL + "/jwks"
+
+	tests := []struct {
+		name          string
+		age           time.Duration
+		refresh       bool
+		wantDownloads int32
+	}{
+		{name: "first fetch", wantDownloads: 1},
+		{name: "cached", age: time.Second, wantDownloads: 0},
+		{name: "refresh too soon", age: time.Second, refresh: true, wantDownloads: 0},
+		{name: "refresh", age: remoteJWKSetMinRefresh, refresh: true, wantDownloads: 1},
+		{name: "expired", age: remoteJWKSetLifetime, wantDownloads: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			remoteJWKSetsLock.Lock()
+			if cached, ok := remoteJWKSets[uri]; ok {
+				cached.fetchedAt = time.Now().Add(-test.age)
+			}
+			remoteJWKSetsLock.Unlock()
+
+			before := downloads.Load()
+
+			_, err := FetchJWKSet(uri, test.refresh)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if got := downloads.Load() - before; got != test.wantDownloads {
+				t.Fatalf("expected %d downloads, got %d", test.wantDownloads, got)
+			}
+		})
+	}
+}
+
+/*
+cachedJWKSet - Returns true if a JWK Set is cached for the URI passed in the uri parameter
+*/
+func cachedJWKSet(uri string) bool {
+	remoteJWKSetsLock.Lock()
+	defer remoteJWKSetsLock.Unlock()
+
+	_, ok := remoteJWKSets[uri]
+	return ok
+}
+
+func TestStoreJWKSetBounded(t *testing.T) {
+	resetJWKSetCache(t)
+
+	for i := 0; i < remoteJWKSetMaxEntries; i++ {
+		storeJWKSet(fmt.Sprintf("https://example.com/%d", i), &JWKSet{})
+	}
+
+	remoteJWKSetsLock.Lock()
+	remoteJWKSets["https://example.com/0"].fetchedAt = time.Now().Add(-time.Minute)
+	remoteJWKSets["https://example.com/1"].fetchedAt = time.Now().Add(-remoteJWKSetLifetime)
+	remoteJWKSetsLock.Unlock()
+
+	storeJWKSet("https://example.com/new", &JWKSet{})
+
+	if cachedJWKSet("https://example.com/1") {
+		t.Fatal("expected the expired set to be removed")
+	}
+
+	if !cachedJWKSet("https://example.com/0") {
+		t.Fatal("expected the oldest set to be kept once an expired set was removed")
+	}
+
+	storeJWKSet("https://example.com/newer", &JWKSet{})
+
+	if cachedJWKSet("https://example.com/0") {
+		t.Fatal("expected the oldest set to be evicted when the cache is full")
+	}
+
+	remoteJWKSetsLock.Lock()
+	defer remoteJWKSetsLock.Unlock()
+
+	if len(remoteJWKSets) != remoteJWKSetMaxEntries {
+		t.Fatalf("expected %d cached sets, got %d", remoteJWKSetMaxEntries, len(remoteJWKSets))
+	}
+}
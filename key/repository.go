@@ -0,0 +1,186 @@
+package key
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrKeyAlreadyExists - Gets returned by CreateKey when a key with the same kid has already been created
+var ErrKeyAlreadyExists = errors.New("key: Key already exists")
+
+// ErrKeyDoesNotExist - Gets returned by GetKey and DeleteKey when a key does not exist
+var ErrKeyDoesNotExist = errors.New("key: Does not exist")
+
+// ErrFetchKeyFailed - Serves as a wrapper around database errors for the GetKey and ListKeys functions
+var ErrFetchKeyFailed = errors.New("key: Failed to fetch key")
+
+// ErrCreateKeyFailed - Serves as a wrapper around database errors for the CreateKey function
+var ErrCreateKeyFailed = errors.New("key: Failed to create key")
+
+// ErrReplaceKeyFailed - Serves as a wrapper around database errors for the ReplaceKey function
+var ErrReplaceKeyFailed = errors.New("key: Failed to replace key")
+
+// ErrDeleteKeyFailed - Serves as a wrapper around database errors for the DeleteKey function
+var ErrDeleteKeyFailed = errors.New("key: Failed to delete key")
+
+/*
+GetKey - Fetch a key using its kid
+*/
+func GetKey(database *server.Database, keyId string) (*Key, error) {
+	var ret Key
+
+	err := database.Find("key", bson.M{"kid": keyId}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrKeyDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchKeyFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+ListKeys - Fetch all keys that are stored in the database
+*/
+func ListKeys(database *server.Database) ([]*Key, error) {
+	var ret []*Key
+
+	err := database.FindMany("key", bson.M{}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchKeyFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+ListKeysByAlgorithm - Fetch all keys that are used for the algorithm passed in the algorithm parameter
+*/
+func ListKeysByAlgorithm(database *server.Database, algorithm api.TokenType) ([]*Key, error) {
+	var ret []*Key
+
+	err := database.FindMany("key", bson.M{"alg": algorithm}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchKeyFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+GetSigningKey - Fetch the active key for the algorithm passed in the algorithm parameter. This
+is the key that new tokens should be signed with
+*/
+func GetSigningKey(database *server.Database, algorithm api.TokenType) (*Key, error) {
+	var ret Key
+
+	err := database.Find("key", bson.M{"alg": algorithm, "status": StatusActive}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrKeyDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchKeyFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+CheckKeyExists - Check to see if a key already exists in the database
+*/
+func CheckKeyExists(database *server.Database, keyId string) (bool, error) {
+	ok, err := database.Exists("key", bson.M{"kid": keyId})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateKey - Insert a new key into the database, and return any errors that may occur
+*/
+func CreateKey(database *server.Database, key *Key) error {
+	ok, err := CheckKeyExists(database, key.KeyID)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateKeyFailed, err)
+	}
+
+	if ok {
+		return ErrKeyAlreadyExists
+	}
+
+	err = database.Insert("key", key)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateKeyFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceKey - Replace a key with the model passed in the key parameter. The kid of the
+model is used to signify which key to replace
+*/
+func ReplaceKey(database *server.Database, key *Key) error {
+	ok, err := CheckKeyExists(database, key.KeyID)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceKeyFailed, err)
+	}
+
+	if !ok {
+		return ErrKeyDoesNotExist
+	}
+
+	err = database.Replace("key", bson.M{"kid": key.KeyID}, key)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceKeyFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteKey - Remove a single key from the database. Tokens signed with this key can no
+longer be verified once it has been removed
+*/
+func DeleteKey(database *server.Database, keyId string) error {
+	ok, err := CheckKeyExists(database, keyId)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteKeyFailed, err)
+	}
+
+	if !ok {
+		return ErrKeyDoesNotExist
+	}
+
+	err = database.Delete("key", bson.M{"kid": keyId})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteKeyFailed, err)
+	}
+
+	return nil
+}
+
+/*
+GetJWKSet - Fetch all keys that are not revoked from the database and convert them into a
+JWK Set. Next keys are included so that resource servers have them cached before they
+start signing tokens, and retired keys are included until every token they signed has expired
+*/
+func GetJWKSet(database *server.Database) (*JWKSet, error) {
+	var keys []*Key
+
+	query := bson.M{"status": bson.M{"$in": bson.A{StatusNext, StatusActive, StatusRetired}}}
+
+	err := database.FindMany("key", query, &keys)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchKeyFailed, err)
+	}
+
+	return NewJWKSet(keys)
+}
@@ -0,0 +1,301 @@
+package key
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+	"time"
+)
+
+// ErrKeyRevoked - Gets returned when a key has been revoked and can no longer be used
+var ErrKeyRevoked = errors.New("key: Key has been revoked")
+
+// ErrRotationInProgress - Gets returned by Rotator.Revoke when another replica is currently rotating keys
+var ErrRotationInProgress = errors.New("key: Rotation is already in progress on another replica")
+
+// rotationLock - The name of the lock that replicas hold while rotating keys
+const rotationLock = "key_rotation"
+
+/*
+Rotator - Rotates the signing keys for each asymmetric algorithm on a schedule. A next key is
+always published ahead of time so that resource servers can cache it before it starts signing
+tokens, and retired keys are kept until every token they signed has expired. Only one replica
+rotates keys at a time, so it is safe to run a Rotator in every Service sharing a database
+*/
+type Rotator struct {
+	// Algorithms - The algorithms that keys should be maintained for
+	Algorithms []api.TokenType
+
+	// Interval - How long a key remains active before it is replaced by the next key
+	Interval time.Duration
+
+	// PrePublish - The minimum amount of time a next key is published before it becomes active
+	PrePublish time.Duration
+
+	// Leeway - Additional time retired keys are kept after their tokens have expired, to account for clock skew
+	Leeway time.Duration
+
+	// owner - A unique identifier for this Rotator, used for holding the rotation lock
+	owner string
+
+	// database - The database that keys are stored in
+	database *server.Database
+}
+
+/*
+NewRotator - A constructor for the Rotator structure
+*/
+func NewRotator(database *server.Database, interval time.Duration, prePublish time.Duration, leeway time.Duration, algorithms ...api.TokenType) *Rotator {
+	return &Rotator{
+		Algorithms: algorithms,
+		Interval:   interval,
+		PrePublish: prePublish,
+		Leeway:     leeway,
+		owner:      uuid.NewString(),
+		database:   database,
+	}
+}
+
+/*
+NewRotatorFromConfig - A wrapper around NewRotator that fills in parameters from Viper. Durations
+are expected to be provided in seconds
+*/
+func NewRotatorFromConfig(database *server.Database) *Rotator {
+	var algorithms []api.TokenType
+	for _, algorithm := range viper.GetStringSlice("key.algorithms") {
+		algorithms = append(algorithms, api.TokenType(algorithm))
+	}
+
+	return NewRotator(
+		database,
+		time.Duration(viper.GetInt("key.rotation_interval"))*time.Second,
+		time.Duration(viper.GetInt("key.pre_publish"))*time.Second,
+		time.Duration(viper.GetInt("token.leeway"))*time.Second,
+		algorithms...,
+	)
+}
+
+/*
+Start - Run Rotate immediately, and then every time the check interval elapses until the
+context is cancelled. This should be called in its own go-routine
+*/
+func (rotator *Rotator) Start(ctx context.Context, check time.Duration) {
+	ticker := time.NewTicker(check)
+	defer ticker.Stop()
+
+	for {
+		err := rotator.Rotate()
+		if err != nil {
+			slog.Error("Failed to rotate signing keys", "err", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+/*
+Rotate - Perform a single rotation pass for each algorithm. If another replica is currently
+rotating, this returns without doing anything
+*/
+func (rotator *Rotator) Rotate() error {
+	ok, err := rotator.database.AcquireLock(rotationLock, rotator.owner, time.Minute)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return nil
+	}
+
+	defer rotator.release()
+
+	for _, algorithm := range rotator.Algorithms {
+		err = rotator.rotate(algorithm, time.Now().UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Revoke - Perform an emergency rotation. The key passed in the keyId parameter is revoked
+immediately, meaning it is removed from the JWK Set and tokens signed with it are no
+longer accepted. If it was the active key, the next key is promoted right away
+*/
+func (rotator *Rotator) Revoke(keyId string) error {
+	ok, err := rotator.database.AcquireLock(rotationLock, rotator.owner, time.Minute)
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		return ErrRotationInProgress
+	}
+
+	defer rotator.release()
+
+	revoked, err := GetKey(rotator.database, keyId)
+	if err != nil {
+		return err
+	}
+
+	wasActive := revoked.Status == StatusActive
+
+	err = rotator.retire(revoked, StatusRevoked, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	slog.Warn("Revoked signing key", "kid", revoked.KeyID, "alg", revoked.Algorithm)
+
+	if !wasActive {
+		return nil
+	}
+
+	/*
+		With the active key revoked, the rotation below promotes the next
+		key immediately. It has already been published in the JWK Set, so
+		resource servers can verify its tokens straight away
+	*/
+	return rotator.rotate(revoked.Algorithm, time.Now().UTC())
+}
+
+/*
+release - Release the rotation lock, logging any errors that occur
+*/
+func (rotator *Rotator) release() {
+	err := rotator.database.ReleaseLock(rotationLock, rotator.owner)
+	if err != nil {
+		slog.Error("Failed to release key rotation lock", "err", err)
+	}
+}
+
+/*
+rotate - Rotate the keys for a single algorithm. Expired retired keys are removed, the
+next key is promoted once its activation date is reached, and a new next key is
+generated if one does not exist
+*/
+func (rotator *Rotator) rotate(algorithm api.TokenType, now time.Time) error {
+	keys, err := ListKeysByAlgorithm(rotator.database, algorithm)
+	if err != nil {
+		return err
+	}
+
+	var active, next *Key
+	for _, key := range keys {
+		switch key.Status {
+		case StatusActive:
+			active = key
+		case StatusNext:
+			next = key
+		case StatusRetired, StatusRevoked:
+			if key.ExpiresAt != 0 && key.ExpiresAt < now.UnixNano() {
+				err = DeleteKey(rotator.database, key.KeyID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	/*
+		On the first run there is nothing to verify, so a key can be
+		activated immediately without being pre-published. Similarly if
+		there is no active key, the next key is promoted regardless of
+		its activation date
+	*/
+	if active == nil && next == nil {
+		next, err = rotator.createNext(algorithm, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	if next != nil && (active == nil || next.ActivatesAt <= now.UnixNano()) {
+		if active != nil {
+			err = rotator.retire(active, StatusRetired, now)
+			if err != nil {
+				return err
+			}
+		}
+
+		next.Status = StatusActive
+		next.ActivatesAt = now.UnixNano()
+		next.Metadata.ModifiedDate = now.UnixNano()
+
+		err = ReplaceKey(rotator.database, next)
+		if err != nil {
+			return err
+		}
+
+		slog.Info("Activated signing key", "kid", next.KeyID, "alg", algorithm)
+
+		active = next
+		next = nil
+	}
+
+	if next == nil {
+		_, err = rotator.createNext(algorithm, time.Unix(0, active.ActivatesAt).Add(rotator.Interval))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+createNext - Generate and store a new next key. The key is scheduled to become active no
+earlier than PrePublish from now
+*/
+func (rotator *Rotator) createNext(algorithm api.TokenType, activatesAt time.Time) (*Key, error) {
+	earliest := time.Now().UTC().Add(rotator.PrePublish)
+	if activatesAt.Before(earliest) {
+		activatesAt = earliest
+	}
+
+	next, err := New(algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	next.ActivatesAt = activatesAt.UnixNano()
+
+	err = CreateKey(rotator.database, next)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("Published next signing key", "kid", next.KeyID, "alg", algorithm, "activates_at", activatesAt)
+
+	return next, nil
+}
+
+/*
+retire - Stop using a key for signing and assign it the status passed in the status parameter. The
+key is kept until the longest lived token that it could have signed has expired
+*/
+func (rotator *Rotator) retire(key *Key, status Status, now time.Time) error {
+	lifetime, err := api.GetMaxTokenLifetime(rotator.database)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceKeyFailed, err)
+	}
+
+	key.Status = status
+	key.RetiredAt = now.UnixNano()
+	key.ExpiresAt = now.Add(time.Duration(lifetime)*time.Second + rotator.Leeway).UnixNano()
+	key.Metadata.ModifiedDate = now.UnixNano()
+
+	return ReplaceKey(rotator.database, key)
+}
@@ -0,0 +1,190 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+// clientAssertionType - The only client_assertion_type supported, as defined in RFC 7523 Section 2.2
+const clientAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// hmacAlgorithms - The algorithms client_secret_jwt assertions can be signed with
+var hmacAlgorithms = []string{"HS256", "HS384", "HS512"}
+
+/*
+usedAssertion - An entry in the client assertion replay cache. The ID is derived from the
+ClientID and the jti of the assertion, so two applications can never collide
+*/
+type usedAssertion struct {
+	// ID - The hex encoded SHA-256 hash of the ClientID and jti of the assertion
+	ID string `bson:"_id"`
+
+	// ExpiresAt - The expiration of the assertion. MongoDB removes the entry after this
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+/*
+authenticateAssertion - Authenticate an application using a JWT client assertion, as described in
+RFC 7523 Section 2.2. With private_key_jwt the assertion is signed with one of the keys registered
+in the JWKS of the application, and with client_secret_jwt it is signed with an HMAC of one of its
+client secrets. Each assertion can only be used once
+*/
+func (provider *Provider) authenticateAssertion(c *gin.Context, service *server.Service) (*application.Application, *Error) {
+	if c.PostForm("client_assertion_type") != clientAssertionType {
+		return nil, errInvalidRequest("The client_assertion_type must be " + clientAssertionType)
+	}
+
+	raw := c.PostForm("client_assertion")
+	if raw == "" {
+		return nil, errInvalidRequest("The client_assertion parameter is required")
+	}
+
+	var unverified jwt.RegisteredClaims
+
+	_, _, err := jwt.NewParser().ParseUnverified(raw, &unverified)
+	if err != nil || unverified.Subject == "" {
+		return nil, errInvalidClient("The client assertion is malformed")
+	}
+
+	clientId := unverified.Subject
+	if c.PostForm("client_id") != "" && c.PostForm("client_id") != clientId {
+		return nil, errInvalidClient("The client_id does not match the client assertion")
+	}
+
+	app, err := application.GetApplicationByClientID(service.Database(), clientId)
+	if err != nil {
+		if errors.Is(err, application.ErrApplicationDoesNotExist) {
+			return nil, errInvalidClient("Client authentication failed")
+		}
+
+		slog.Error("Failed to fetch application", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	var keyfunc jwt.Keyfunc
+	var algorithms []string
+
+	switch {
+	case app.TokenEndpointAuthMethod == application.PrivateKeyJWT:
+		keyfunc, algorithms = applicationKeyfunc(app), applicationAlgorithms
+	case app.TokenEndpointAuthMethod == application.ClientSecretJWT && provider.clientSecretJWTEnabled():
+		keyfunc, algorithms = provider.hmacKeyfunc(app), hmacAlgorithms
+	default:
+		return nil, errInvalidClient("The application cannot authenticate with a client assertion")
+	}
+
+	var claims jwt.RegisteredClaims
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(algorithms),
+		jwt.WithIssuer(clientId),
+		jwt.WithSubject(clientId),
+		jwt.WithLeeway(provider.Leeway),
+		jwt.WithExpirationRequired(),
+	)
+
+	_, err = parser.ParseWithClaims(raw, &claims, keyfunc)
+	if err != nil {
+		slog.Warn("Rejected client assertion", "client_id", clientId, "err", err)
+		return nil, errInvalidClient("Client authentication failed")
+	}
+
+	/*
+		RFC 7523 expects the audience to be the endpoint the assertion is sent to,
+		but the issuer identifier is also accepted as it identifies simple-idp
+	*/
+	audience := []string{provider.Issuer, provider.endpoint(c.Request.URL.Path)}
+	if !slices.ContainsFunc(claims.Audience, func(value string) bool { return slices.Contains(audience, value) }) {
+		return nil, errInvalidClient("The audience of the client assertion is invalid")
+	}
+
+	if claims.ID == "" {
+		return nil, errInvalidClient("The client assertion must contain a jti")
+	}
+
+	digest := sha256.Sum256([]byte(clientId + ":" + claims.ID))
+
+	err = service.Database().Insert("client_assertion", &usedAssertion{
+		ID:        hex.EncodeToString(digest[:]),
+		ExpiresAt: claims.ExpiresAt.Time.Add(provider.Leeway),
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errInvalidClient("The client assertion has already been used")
+		}
+
+		slog.Error("Failed to record client assertion", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	return app, nil
+}
+
+/*
+clientSecretJWTEnabled - Returns true if the Provider has a ClientSecretEncryptionKey, which is
+needed to seal and open the secrets of applications using client_secret_jwt
+*/
+func (provider *Provider) clientSecretJWTEnabled() bool {
+	return len(provider.ClientSecretEncryptionKey) == 32
+}
+
+/*
+hmacKeyfunc - Returns a jwt.Keyfunc that resolves the HMAC keys a client_secret_jwt assertion may
+have been signed with. Every secret of the application that has not expired is tried, so that
+assertions keep working while a secret is rotated
+*/
+func (provider *Provider) hmacKeyfunc(app *application.Application) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		keys, err := app.HMACKeys(provider.ClientSecretEncryptionKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(keys) == 0 {
+			return nil, ErrNoApplicationKey
+		}
+
+		set := jwt.VerificationKeySet{}
+		for _, key := range keys {
+			set.Keys = append(set.Keys, key)
+		}
+
+		return set, nil
+	}
+}
+
+/*
+sealClientSecret - Seal the secret passed in the raw parameter into the newest ClientSecret of the
+application if it uses client_secret_jwt. Must be called whenever such an application is issued a
+secret, as the secret cannot be recovered from its hash afterwards
+*/
+func (provider *Provider) sealClientSecret(app *application.Application, raw string) *Error {
+	if app.TokenEndpointAuthMethod != application.ClientSecretJWT {
+		return nil
+	}
+
+	if !provider.clientSecretJWTEnabled() {
+		return errInvalidClientMetadata("The client_secret_jwt auth method is not enabled")
+	}
+
+	if raw == "" || len(app.ClientSecrets) == 0 {
+		return nil
+	}
+
+	err := app.ClientSecrets[len(app.ClientSecrets)-1].SealHMACKey(raw, provider.ClientSecretEncryptionKey)
+	if err != nil {
+		slog.Error("Failed to seal client secret", "client_id", app.ClientID, "err", err)
+		return errServerError()
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package oauth
+
+import (
+	"bytes"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"testing"
+	"time"
+)
+
+// testHashingParameters - Cheap argon2id parameters, so that tests can issue client secrets quickly
+var testHashingParameters = user.NewHashingParameters(32, 16, 1, 1024, 1)
+
+/*
+newClientSecretJWTApplication - Build an application using client_secret_jwt with a single secret
+sealed by the provider, and return the secret
+*/
+func newClientSecretJWTApplication(t *testing.T, provider *Provider) (*application.Application, string) {
+	t.Helper()
+
+	app := &application.Application{ClientID: "client-1", TokenEndpointAuthMethod: application.ClientSecretJWT}
+
+	_, secret, err := app.AddClientSecret(testHashingParameters, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authErr := provider.sealClientSecret(app, secret)
+	if authErr != nil {
+		t.Fatal(authErr)
+	}
+
+	return app, secret
+}
+
+func TestHMACKeyfunc(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer, ClientSecretEncryptionKey: bytes.Repeat([]byte{1}, 32)}
+	app, secret := newClientSecretJWTApplication(t, provider)
+
+	claims := jwt.RegisteredClaims{
+		Issuer:    app.ClientID,
+		Subject:   app.ClientID,
+		Audience:  jwt.ClaimStrings{testIssuer},
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		ID:        "assertion-1",
+	}
+
+	sign := func(method jwt.SigningMethod, key []byte) string {
+		signed, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "HS256 with the secret", raw: sign(jwt.SigningMethodHS256, []byte(secret))},
+		{name: "HS512 with the secret", raw: sign(jwt.SigningMethodHS512, []byte(secret))},
+		{name: "another secret", raw: sign(jwt.SigningMethodHS256, []byte("another-secret-that-is-long-enough")), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parser := jwt.NewParser(jwt.WithValidMethods(hmacAlgorithms))
+
+			_, err := parser.ParseWithClaims(test.raw, &jwt.RegisteredClaims{}, provider.hmacKeyfunc(app))
+			if test.wantErr != (err != nil) {
+				t.Fatalf("wantErr %v, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSealClientSecret(t *testing.T) {
+	enabled := &Provider{ClientSecretEncryptionKey: bytes.Repeat([]byte{1}, 32)}
+	disabled := &Provider{}
+
+	tests := []struct {
+		name     string
+		provider *Provider
+		method   application.AuthMethod
+		sealed   bool
+		wantCode string
+	}{
+		{name: "client_secret_jwt", provider: enabled, method: application.ClientSecretJWT, sealed: true},
+		{name: "client_secret_jwt disabled", provider: disabled, method: application.ClientSecretJWT, wantCode: "invalid_client_metadata"},
+		{name: "client_secret_basic", provider: enabled, method: application.ClientSecretBasic},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			app := &application.Application{ClientID: "client-1", TokenEndpointAuthMethod: test.method}
+
+			_, secret, err := app.AddClientSecret(testHashingParameters, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			authErr := test.provider.sealClientSecret(app, secret)
+			if test.wantCode != "" {
+				if authErr == nil || authErr.Code != test.wantCode {
+					t.Fatalf("expected %s, got %v", test.wantCode, authErr)
+				}
+				return
+			}
+
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+
+			if sealed := app.ClientSecrets[0].HMACKey != ""; sealed != test.sealed {
+				t.Fatalf("sealed = %v, want %v", sealed, test.sealed)
+			}
+		})
+	}
+}
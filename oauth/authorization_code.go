@@ -0,0 +1,126 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"slices"
+)
+
+/*
+authorizationCode - Handles the authorization_code grant described in RFC 6749 Section 4.1.3. The
+code is only consumed once the client, redirect_uri and PKCE code_verifier have been validated
+against the values sent to the authorization endpoint
+*/
+func (provider *Provider) authorizationCode(c *gin.Context, service *server.Service, app *application.Application) (*TokenResponse, *Error) {
+	raw := c.PostForm("code")
+	if raw == "" {
+		return nil, errInvalidRequest("The code parameter is required")
+	}
+
+	verifier := c.PostForm("code_verifier")
+	if verifier == "" {
+		return nil, errInvalidRequest("The code_verifier parameter is required")
+	}
+
+	code, err := getAuthorizationCode(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, ErrCodeDoesNotExist) {
+			return nil, errInvalidGrant("The authorization code is invalid or has expired")
+		}
+
+		slog.Error("Failed to fetch authorization code", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	if code.ClientID != app.ClientID {
+		return nil, errInvalidGrant("The authorization code was issued to another application")
+	}
+
+	if !code.matchesRedirectURI(c.PostForm("redirect_uri")) {
+		return nil, errInvalidGrant("The redirect_uri does not match the authorization request")
+	}
+
+	if !verifyCodeVerifier(verifier, code.CodeChallenge) {
+		return nil, errInvalidGrant("The code_verifier does not match the code_challenge")
+	}
+
+	err = consumeAuthorizationCode(service.Database(), code)
+	if err != nil {
+		if errors.Is(err, ErrCodeDoesNotExist) || errors.Is(err, ErrCodeReused) {
+			return nil, errInvalidGrant("The authorization code is invalid or has expired")
+		}
+
+		slog.Error("Failed to consume authorization code", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	target, err := provider.resolveAPI(service.Database(), code.Audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidGrant("The API the code was issued for no longer exists")
+		}
+
+		slog.Error("Failed to fetch API", "audience", code.Audience, "err", err)
+		return nil, errServerError()
+	}
+
+	accessToken, claims, err := provider.issueAccessToken(c, service, target, code.Subject, false, app.ClientID, code.Scope, nil)
+	if err != nil {
+		slog.Error("Failed to issue access token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   target.TokenLifetime,
+		Scope:       scope.Format(code.Scope),
+	}
+
+	if slices.Contains(code.Scope, "openid") {
+		response.IDToken, err = provider.issueIDToken(service.Database(), app.ClientID, code.Subject, code.Scope, code.AuthTime, code.Nonce, accessToken, raw)
+		if err != nil {
+			slog.Error("Failed to issue ID token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+	}
+
+	familyId := ""
+	if app.HasGrantType(application.RefreshToken) {
+		refresh, err := token.NewRefreshToken(app.ClientID, code.Subject, target, code.Scope, code.AuthTime)
+		if err != nil {
+			slog.Error("Failed to build refresh token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+
+		/*
+			Refresh tokens issued to public clients are bound to the key the request
+			was made with, as they are not otherwise tied to the application
+		*/
+		if app.IsPublic() {
+			refresh.Confirmation = confirmation(c)
+		}
+
+		response.RefreshToken, err = token.CreateRefreshToken(service.Database(), refresh)
+		if err != nil {
+			slog.Error("Failed to create refresh token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+
+		familyId = refresh.FamilyID
+	}
+
+	err = recordIssuedToken(service.Database(), code, IssuedToken{ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}, familyId)
+	if err != nil {
+		slog.Error("Failed to record issued token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	return response, nil
+}
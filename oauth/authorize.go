@@ -0,0 +1,348 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+/*
+authorizationRequest - The parameters of a RFC 6749 Section 4.1.1 authorization request
+*/
+type authorizationRequest struct {
+	// ClientID - The ClientID of the application requesting authorization
+	ClientID string
+
+	// RedirectURI - Where the user is sent back to once the request has been processed
+	RedirectURI string
+
+	// RedirectURIProvided - True if the application sent the redirect_uri, rather than it being filled in from its only registered URI
+	RedirectURIProvided bool
+
+	// ResponseType - The response type requested by the application. Only code is supported
+	ResponseType string
+
+	// Scope - The scopes requested by the application
+	Scope []string
+
+	// State - An opaque value used by the application to protect against CSRF
+	State string
+
+	// CodeChallenge - The PKCE code challenge
+	CodeChallenge string
+
+	// CodeChallengeMethod - The PKCE code challenge method. Only S256 is supported
+	CodeChallengeMethod string
+
+	// Audience - The audience of the API the application is requesting access to
+	Audience string
+
+	// Prompt - Set to none if the user should not be prompted to sign in
+	Prompt string
+
+	// Nonce - An OpenID Connect value that is passed through to the ID token to prevent replay
+	Nonce string
+}
+
+/*
+newAuthorizationRequest - Build an authorizationRequest from query or form parameters
+*/
+func newAuthorizationRequest(values url.Values) *authorizationRequest {
+	return &authorizationRequest{
+		ClientID:            values.Get("client_id"),
+		RedirectURI:         values.Get("redirect_uri"),
+		RedirectURIProvided: values.Get("redirect_uri") != "",
+		ResponseType:        values.Get("response_type"),
+		Scope:               scope.Parse(values.Get("scope")),
+		State:               values.Get("state"),
+		CodeChallenge:       values.Get("code_challenge"),
+		CodeChallengeMethod: values.Get("code_challenge_method"),
+		Audience:            values.Get("audience"),
+		Prompt:              values.Get("prompt"),
+		Nonce:               values.Get("nonce"),
+	}
+}
+
+/*
+Authorize - A server.HandlerFunc for the authorization endpoint. Should be registered under
+GET /authorize. Only the authorization code flow is supported, and PKCE with the S256
+method is mandatory for every application. The parameters can also be pushed to the PAR
+endpoint beforehand, or sent in a signed request object, and referenced with the request_uri
+parameter
+*/
+func (provider *Provider) Authorize(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		err := c.Request.ParseForm()
+		if err != nil {
+			abort(c, errInvalidRequest("Malformed request parameters"))
+			return
+		}
+
+		var pushed *PushedRequest
+		values := c.Request.Form
+
+		/*
+			A request_uri either references a pushed request, which has already been
+			validated by the PAR endpoint, or a request object hosted by the application
+		*/
+		if strings.HasPrefix(values.Get("request_uri"), requestURIPrefix) {
+			var authErr *Error
+
+			pushed, authErr = resolvePushedRequest(service.Database(), values)
+			if authErr != nil {
+				abort(c, authErr)
+				return
+			}
+
+			values = pushed.Parameters
+		} else {
+			var authErr *Error
+
+			values, authErr = provider.expandRequestObject(service.Database(), values)
+			if authErr != nil {
+				abort(c, authErr)
+				return
+			}
+		}
+
+		request := newAuthorizationRequest(values)
+
+		/*
+			Until the application and redirect_uri have been validated, errors are
+			shown to the user directly. Redirecting to an unvalidated URI would turn
+			the authorization endpoint into an open redirector
+		*/
+		app, authErr := resolveAuthorizationClient(service.Database(), request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if app.RequirePushedAuthorizationRequests && pushed == nil {
+			provider.redirectError(c, request, errInvalidRequest("The application requires pushed authorization requests"))
+			return
+		}
+
+		target, authErr := provider.validateAuthorizationRequest(service.Database(), app, request)
+		if authErr != nil {
+			provider.redirectError(c, request, authErr)
+			return
+		}
+
+		session, err := provider.session(service, c)
+		if err != nil {
+			slog.Error("Failed to resolve user session", "err", err)
+			provider.redirectError(c, request, errServerError())
+			return
+		}
+
+		if session == nil {
+			if request.Prompt == "none" || provider.LoginURL == "" {
+				provider.redirectError(c, request, errLoginRequired())
+				return
+			}
+
+			provider.redirectLogin(c)
+			return
+		}
+
+		if !slices.Contains(session.User.Applications, app.Metadata.Id) {
+			provider.redirectError(c, request, errAccessDenied("The user is not authorized to access this application"))
+			return
+		}
+
+		if pushed != nil {
+			err = consumePushedRequest(service.Database(), pushed)
+			if err != nil {
+				if errors.Is(err, ErrPushedRequestDoesNotExist) {
+					provider.redirectError(c, request, errInvalidRequest("The request_uri has already been used"))
+					return
+				}
+
+				slog.Error("Failed to consume pushed authorization request", "client_id", app.ClientID, "err", err)
+				provider.redirectError(c, request, errServerError())
+				return
+			}
+		}
+
+		code, err := createAuthorizationCode(service.Database(), &AuthorizationCode{
+			ClientID:            app.ClientID,
+			RedirectURI:         request.RedirectURI,
+			RedirectURIProvided: request.RedirectURIProvided,
+			Subject:             session.User.Metadata.Id,
+			Audience:            target.Audience,
+			Scope:               grantScopes(target, request.Scope),
+			CodeChallenge:       request.CodeChallenge,
+			Nonce:               request.Nonce,
+			AuthTime:            session.AuthTime.Unix(),
+		})
+		if err != nil {
+			slog.Error("Failed to create authorization code", "client_id", app.ClientID, "err", err)
+			provider.redirectError(c, request, errServerError())
+			return
+		}
+
+		provider.redirect(c, request, url.Values{"code": {code}})
+	}
+}
+
+/*
+resolveAuthorizationClient - Fetch the application making the authorization request and
+validate the redirect_uri against the URIs registered with it. If the redirect_uri is
+omitted, the application must have exactly one registered URI, which cannot be a wildcard
+*/
+func resolveAuthorizationClient(database *server.Database, request *authorizationRequest) (*application.Application, *Error) {
+	if request.ClientID == "" {
+		return nil, errInvalidRequest("The client_id parameter is required")
+	}
+
+	app, err := application.GetApplicationByClientID(database, request.ClientID)
+	if err != nil {
+		if errors.Is(err, application.ErrApplicationDoesNotExist) {
+			return nil, errInvalidRequest("The client_id parameter is invalid")
+		}
+
+		slog.Error("Failed to fetch application", "client_id", request.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	if request.RedirectURI == "" {
+		if len(app.RedirectURIs) != 1 || strings.Contains(app.RedirectURIs[0], "*") {
+			return nil, errInvalidRequest("The redirect_uri parameter is required")
+		}
+
+		request.RedirectURI = app.RedirectURIs[0]
+		return app, nil
+	}
+
+	if !app.HasRedirectURI(request.RedirectURI) {
+		return nil, errInvalidRequest("The redirect_uri has not been registered with the application")
+	}
+
+	return app, nil
+}
+
+/*
+validateAuthorizationRequest - Validate the remaining parameters of the authorization request
+and resolve the API that access is being requested for. Errors returned from here can be safely
+redirected back to the application
+*/
+func (provider *Provider) validateAuthorizationRequest(database *server.Database, app *application.Application, request *authorizationRequest) (*api.API, *Error) {
+	if request.ResponseType != "code" {
+		return nil, errUnsupportedResponseType("Only the code response type is supported")
+	}
+
+	if !app.HasGrantType(application.AuthorizationCodePKCE) {
+		return nil, errUnauthorizedClient("The application is not allowed to use the authorization code grant")
+	}
+
+	if request.State == "" {
+		return nil, errInvalidRequest("The state parameter is required")
+	}
+
+	if request.CodeChallenge == "" {
+		return nil, errInvalidRequest("PKCE is required, the code_challenge parameter is missing")
+	}
+
+	if request.CodeChallengeMethod != "S256" {
+		return nil, errInvalidRequest("The code_challenge_method must be S256")
+	}
+
+	if !validCodeChallenge(request.CodeChallenge) {
+		return nil, errInvalidRequest("The code_challenge parameter is malformed")
+	}
+
+	return provider.requestedAPI(database, request.Audience, request.Scope)
+}
+
+/*
+requestedAPI - Resolve the API that a user is being asked to grant access to. If the openid scope
+is requested without an audience, access is granted to the userinfo endpoint
+*/
+func (provider *Provider) requestedAPI(database *server.Database, audience string, scopes []string) (*api.API, *Error) {
+	if audience == "" {
+		if !slices.Contains(scopes, "openid") {
+			return nil, errInvalidRequest("The audience parameter is required")
+		}
+
+		audience = provider.userinfoAudience()
+	}
+
+	target, err := provider.resolveAPI(database, audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidTarget("The requested audience does not exist")
+		}
+
+		slog.Error("Failed to fetch API", "audience", audience, "err", err)
+		return nil, errServerError()
+	}
+
+	return target, nil
+}
+
+/*
+redirect - Send the user back to the redirect_uri of the request with the parameters passed
+in the params parameter. The state and issuer are always included, the latter as described
+in RFC 9207 so that applications can detect mix-up attacks
+*/
+func (provider *Provider) redirect(c *gin.Context, request *authorizationRequest, params url.Values) {
+	location, err := url.Parse(request.RedirectURI)
+	if err != nil {
+		abort(c, errInvalidRequest("The redirect_uri parameter is malformed"))
+		return
+	}
+
+	if request.State != "" {
+		params.Set("state", request.State)
+	}
+	params.Set("iss", provider.Issuer)
+
+	query := location.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	location.RawQuery = query.Encode()
+
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusFound, location.String())
+}
+
+/*
+redirectError - Send the user back to the redirect_uri of the request with an error response
+*/
+func (provider *Provider) redirectError(c *gin.Context, request *authorizationRequest, authErr *Error) {
+	params := url.Values{"error": {authErr.Code}}
+	if authErr.Description != "" {
+		params.Set("error_description", authErr.Description)
+	}
+
+	provider.redirect(c, request, params)
+}
+
+/*
+redirectLogin - Send the user to the LoginURL. The authorization request is passed in the
+return_to parameter so that the login UI can resume it once the user has signed in
+*/
+func (provider *Provider) redirectLogin(c *gin.Context) {
+	location, err := url.Parse(provider.LoginURL)
+	if err != nil {
+		slog.Error("Failed to parse login URL", "err", err)
+		abort(c, errServerError())
+		return
+	}
+
+	query := location.Query()
+	query.Set("return_to", c.Request.URL.RequestURI())
+	location.RawQuery = query.Encode()
+
+	c.Redirect(http.StatusFound, location.String())
+}
@@ -0,0 +1,113 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+	"net/url"
+)
+
+/*
+authenticateClient - Authenticate the application making the request. Credentials are accepted
+either through HTTP Basic authentication, through the client_id and client_secret form parameters,
+as described in RFC 6749 Section 2.3.1, or through a JWT client assertion. Using more than one at
+once is rejected. Public clients, and applications using mutual TLS, only identify themselves with
+the client_id form parameter
+*/
+func (provider *Provider) authenticateClient(c *gin.Context, service *server.Service) (*application.Application, *Error) {
+	database := service.Database()
+
+	clientId, clientSecret, ok := c.Request.BasicAuth()
+
+	if c.PostForm("client_assertion") != "" || c.PostForm("client_assertion_type") != "" {
+		if ok || c.PostForm("client_secret") != "" {
+			return nil, errInvalidRequest("Multiple client authentication methods were used")
+		}
+
+		return provider.authenticateAssertion(c, service)
+	}
+
+	if ok {
+		if c.PostForm("client_secret") != "" {
+			return nil, errInvalidRequest("Multiple client authentication methods were used")
+		}
+
+		/*
+			RFC 6749 requires the client credentials to be form encoded before
+			they are placed in the Authorization header
+		*/
+		var err error
+		clientId, err = url.QueryUnescape(clientId)
+		if err != nil {
+			return nil, errInvalidClient("Malformed client credentials")
+		}
+
+		clientSecret, err = url.QueryUnescape(clientSecret)
+		if err != nil {
+			return nil, errInvalidClient("Malformed client credentials")
+		}
+	} else {
+		clientId = c.PostForm("client_id")
+		clientSecret = c.PostForm("client_secret")
+	}
+
+	if clientId == "" {
+		return nil, errInvalidClient("Client authentication is required")
+	}
+
+	app, err := application.GetApplicationByClientID(database, clientId)
+	if err != nil {
+		if errors.Is(err, application.ErrApplicationDoesNotExist) {
+			return nil, errInvalidClient("Client authentication failed")
+		}
+
+		slog.Error("Failed to fetch application", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	switch app.TokenEndpointAuthMethod {
+	case application.TLSClientAuth, application.SelfSignedTLSClientAuth:
+		if ok || clientSecret != "" {
+			return nil, errInvalidClient("Applications using mutual TLS cannot authenticate with a client secret")
+		}
+
+		authErr := authenticateCertificate(c, service, app)
+		if authErr != nil {
+			return nil, authErr
+		}
+
+		return app, nil
+	case application.PrivateKeyJWT, application.ClientSecretJWT:
+		return nil, errInvalidClient("The application must authenticate with a client assertion")
+	}
+
+	if app.IsPublic() {
+		if ok || clientSecret != "" {
+			return nil, errInvalidClient("Public clients cannot authenticate with a client secret")
+		}
+
+		return app, nil
+	}
+
+	if clientSecret == "" {
+		return nil, errInvalidClient("Client authentication failed")
+	}
+
+	secret := app.MatchClientSecret(clientSecret)
+	if secret == nil {
+		return nil, errInvalidClient("Client authentication failed")
+	}
+
+	/*
+		Failing to record when the secret was used should not stop the
+		application from authenticating
+	*/
+	err = application.RecordClientSecretUse(database, app.ClientID, secret)
+	if err != nil {
+		slog.Warn("Failed to record client secret use", "client_id", app.ClientID, "secret_id", secret.ID, "err", err)
+	}
+
+	return app, nil
+}
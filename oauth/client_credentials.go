@@ -0,0 +1,74 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/grant"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+)
+
+// clientSubjectSuffix - Appended to the ClientID of an application to form the subject of tokens it is issued for itself
+const clientSubjectSuffix = "@clients"
+
+/*
+clientCredentials - Handles the client_credentials grant described in RFC 6749 Section 4.4. The
+application is issued a token for the API identified by the audience parameter, but only if it has
+been given a grant for that API. If no scope is requested, every scope of the grant is issued
+*/
+func (provider *Provider) clientCredentials(c *gin.Context, service *server.Service, app *application.Application) (*TokenResponse, *Error) {
+	if app.IsPublic() {
+		return nil, errUnauthorizedClient("Public clients cannot use the client_credentials grant")
+	}
+
+	audience := c.PostForm("audience")
+	if audience == "" {
+		return nil, errInvalidRequest("The audience parameter is required")
+	}
+
+	target, err := api.GetAPIByAudience(service.Database(), audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidTarget("The requested audience does not exist")
+		}
+
+		slog.Error("Failed to fetch API", "audience", audience, "err", err)
+		return nil, errServerError()
+	}
+
+	clientGrant, err := grant.GetGrant(service.Database(), app.Metadata.Id, target.Metadata.Id)
+	if err != nil {
+		if errors.Is(err, grant.ErrGrantDoesNotExist) {
+			return nil, errUnauthorizedClient("The application has not been granted access to the API")
+		}
+
+		slog.Error("Failed to fetch client grant", "client_id", app.ClientID, "audience", audience, "err", err)
+		return nil, errServerError()
+	}
+
+	scopes := clientGrant.FilterScope(target, clientGrant.Scope)
+
+	requested := scope.Parse(c.PostForm("scope"))
+	if len(requested) != 0 {
+		scopes = clientGrant.FilterScope(target, requested)
+		if len(scopes) == 0 {
+			return nil, errInvalidScope("None of the requested scopes have been granted to the application")
+		}
+	}
+
+	accessToken, _, err := provider.issueAccessToken(c, service, target, app.ClientID+clientSubjectSuffix, true, app.ClientID, scopes, nil)
+	if err != nil {
+		slog.Error("Failed to issue access token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	return &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   target.TokenLifetime,
+		Scope:       scope.Format(scopes),
+	}, nil
+}
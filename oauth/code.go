@@ -0,0 +1,235 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/rand"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"log/slog"
+	"time"
+)
+
+// ErrCodeDoesNotExist - Gets returned by getAuthorizationCode when a code does not exist or has expired
+var ErrCodeDoesNotExist = errors.New("oauth: Authorization code does not exist")
+
+// ErrCodeReused - Gets returned by consumeAuthorizationCode when a code that has already been exchanged is used again
+var ErrCodeReused = errors.New("oauth: Authorization code has already been used")
+
+// authorizationCodeLifetime - How long an authorization code can be exchanged for after it was issued
+const authorizationCodeLifetime = time.Minute
+
+/*
+IssuedToken - A reference to a token that was issued from an authorization grant. These are
+kept so that the tokens can be revoked if the grant is found to be compromised
+*/
+type IssuedToken struct {
+	// ID - The jti of the token
+	ID string `json:"jti" bson:"jti"`
+
+	// ExpiresAt - The expiration of the token
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+AuthorizationCode - A single use authorization code issued by the authorization endpoint. Only
+the SHA-256 hash of the code is stored, so a leaked database cannot be used to redeem codes
+*/
+type AuthorizationCode struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// Hash - The hex encoded SHA-256 hash of the code
+	Hash string `json:"hash" bson:"hash"`
+
+	// ClientID - The ClientID of the application the code was issued to
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	// RedirectURI - The redirect_uri the code was delivered to
+	RedirectURI string `json:"redirect_uri" bson:"redirect_uri"`
+
+	// RedirectURIProvided - True if the redirect_uri was sent in the authorization request, in which case it must be repeated when exchanging the code
+	RedirectURIProvided bool `json:"redirect_uri_provided" bson:"redirect_uri_provided"`
+
+	// Subject - The ID of the user that authorized the application
+	Subject string `json:"subject" bson:"subject"`
+
+	// Audience - The audience of the API the access token is issued for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Scope - The scopes that were granted
+	Scope []string `json:"scope" bson:"scope"`
+
+	// CodeChallenge - The S256 PKCE code challenge sent to the authorization endpoint
+	CodeChallenge string `json:"code_challenge" bson:"code_challenge"`
+
+	// Nonce - The OpenID Connect nonce sent in the authorization request
+	Nonce string `json:"nonce" bson:"nonce"`
+
+	// AuthTime - The time that the user last actively authenticated
+	AuthTime int64 `json:"auth_time" bson:"auth_time"`
+
+	// Used - Set to true once the code has been exchanged
+	Used bool `json:"used" bson:"used"`
+
+	// Tokens - The tokens that have been issued using this code
+	Tokens []IssuedToken `json:"tokens" bson:"tokens"`
+
+	// RefreshTokenFamily - The FamilyID of the refresh tokens issued using this code, if any
+	RefreshTokenFamily string `json:"refresh_token_family" bson:"refresh_token_family"`
+
+	// ExpiresAt - The time after which the code can no longer be exchanged. MongoDB removes the code after this
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+matchesRedirectURI - Returns true if the redirect_uri sent to the token endpoint is acceptable for
+the code. RFC 6749 Section 4.1.3 only requires it if it was sent in the authorization request, but
+a redirect_uri that is sent anyway must still match the one the code was delivered to
+*/
+func (code *AuthorizationCode) matchesRedirectURI(redirectUri string) bool {
+	if !code.RedirectURIProvided && redirectUri == "" {
+		return true
+	}
+
+	return code.RedirectURI == redirectUri
+}
+
+/*
+newHandle - Generate a random 256-bit value that is safe to include in URLs. Used for
+authorization codes and other single use values handed out to clients
+*/
+func newHandle() (string, error) {
+	return rand.URLSafeString(32)
+}
+
+/*
+hashHandle - Returns the hex encoded SHA-256 hash of a handle. Handles have enough entropy
+that a salt is not needed
+*/
+func hashHandle(handle string) string {
+	digest := sha256.Sum256([]byte(handle))
+	return hex.EncodeToString(digest[:])
+}
+
+/*
+createAuthorizationCode - Generate a new authorization code and store it in the database. The
+raw code is returned, and is the only time it is available
+*/
+func createAuthorizationCode(database *server.Database, code *AuthorizationCode) (string, error) {
+	raw, err := newHandle()
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := metadata.New()
+	if err != nil {
+		return "", err
+	}
+
+	code.Metadata = meta
+	code.Hash = hashHandle(raw)
+	code.Tokens = []IssuedToken{}
+	code.ExpiresAt = time.Now().UTC().Add(authorizationCodeLifetime)
+
+	err = database.Insert("authorization_code", code)
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+/*
+getAuthorizationCode - Fetch an authorization code that has not expired, without consuming it. The
+code must be validated against the token request before consumeAuthorizationCode is called, so
+that someone presenting an intercepted code with the wrong values cannot burn it
+*/
+func getAuthorizationCode(database *server.Database, raw string) (*AuthorizationCode, error) {
+	var ret AuthorizationCode
+
+	err := database.Find("authorization_code", bson.M{"hash": hashHandle(raw)}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrCodeDoesNotExist
+		}
+		return nil, err
+	}
+
+	if ret.ExpiresAt.Before(time.Now().UTC()) {
+		return nil, ErrCodeDoesNotExist
+	}
+
+	return &ret, nil
+}
+
+/*
+consumeAuthorizationCode - Atomically mark a validated authorization code as used. If the code has
+already been used, every token issued from it is revoked and ErrCodeReused is returned
+*/
+func consumeAuthorizationCode(database *server.Database, code *AuthorizationCode) error {
+	var ret AuthorizationCode
+
+	err := database.FindAndUpdate(
+		"authorization_code",
+		bson.M{"hash": code.Hash, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+		&ret,
+	)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	err = database.Find("authorization_code", bson.M{"hash": code.Hash}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrCodeDoesNotExist
+		}
+		return err
+	}
+
+	/*
+		The code has been exchanged before by a request that presented the same client,
+		redirect_uri and code_verifier, which means it was likely intercepted. RFC 6749
+		Section 4.1.2 recommends revoking every token that was issued from it
+	*/
+	slog.Warn("Authorization code was reused, revoking issued tokens", "client_id", ret.ClientID, "subject", ret.Subject)
+
+	for _, issued := range ret.Tokens {
+		err = token.Revoke(database, issued.ID, issued.ExpiresAt)
+		if err != nil {
+			return fmt.Errorf("%w: (%s)", ErrCodeReused, err)
+		}
+	}
+
+	if ret.RefreshTokenFamily != "" {
+		err = token.RevokeRefreshTokenFamily(database, ret.RefreshTokenFamily)
+		if err != nil {
+			return fmt.Errorf("%w: (%s)", ErrCodeReused, err)
+		}
+	}
+
+	return ErrCodeReused
+}
+
+/*
+recordIssuedToken - Associate an access token, and the family of any refresh token, with the
+authorization code they were issued from
+*/
+func recordIssuedToken(database *server.Database, code *AuthorizationCode, issued IssuedToken, familyId string) error {
+	update := bson.M{"$push": bson.M{"tokens": issued}}
+	if familyId != "" {
+		update["$set"] = bson.M{"refresh_token_family": familyId}
+	}
+
+	return database.Update("authorization_code", bson.M{"hash": code.Hash}, update)
+}
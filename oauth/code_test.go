@@ -0,0 +1,39 @@
+package oauth
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestMatchesRedirectURI(t *testing.T) {
+	const registered = "https://app.example.com/cb"
+
+	tests := []struct {
+		name      string
+		authorize url.Values
+		presented string
+		want      bool
+	}{
+		{name: "sent in both", authorize: url.Values{"redirect_uri": {registered}}, presented: registered, want: true},
+		{name: "sent in authorization request only", authorize: url.Values{"redirect_uri": {registered}}, presented: "", want: false},
+		{name: "different in token request", authorize: url.Values{"redirect_uri": {registered}}, presented: "https://app.example.com/other", want: false},
+		{name: "omitted in both", authorize: url.Values{}, presented: "", want: true},
+		{name: "omitted in authorization request but matching", authorize: url.Values{}, presented: registered, want: true},
+		{name: "omitted in authorization request and different", authorize: url.Values{}, presented: "https://app.example.com/other", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := newAuthorizationRequest(test.authorize)
+			if request.RedirectURI == "" {
+				request.RedirectURI = registered
+			}
+
+			code := &AuthorizationCode{RedirectURI: request.RedirectURI, RedirectURIProvided: request.RedirectURIProvided}
+
+			if got := code.matchesRedirectURI(test.presented); got != test.want {
+				t.Fatalf("matchesRedirectURI() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/rand"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"strings"
+	"time"
+)
+
+// ErrDeviceCodeDoesNotExist - Gets returned when a device code or user code does not exist, or is no longer pending
+var ErrDeviceCodeDoesNotExist = errors.New("oauth: Device code does not exist")
+
+// deviceCodeLifetime - How long a user has to approve a device authorization request
+const deviceCodeLifetime = 10 * time.Minute
+
+// deviceCodeInterval - The minimum number of seconds an application must wait between polling requests
+const deviceCodeInterval = 5
+
+/*
+userCodeAlphabet - The characters user codes are generated from. Vowels are excluded so that
+codes never spell words, and so are characters that are easily confused with each other, as
+recommended by RFC 8628 Section 6.1
+*/
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// userCodeLength - The number of characters in a user code, excluding the separator
+const userCodeLength = 8
+
+// maxDeviceAttempts - The number of invalid user codes a user can submit before they are locked out of the verification page
+const maxDeviceAttempts = 5
+
+// deviceAttemptWindow - How long invalid user codes are counted for, and how long a user stays locked out once they reach maxDeviceAttempts
+const deviceAttemptWindow = 15 * time.Minute
+
+type DeviceStatus string
+
+const (
+	// DevicePending - The user has not yet approved or denied the request
+	DevicePending DeviceStatus = "pending"
+
+	// DeviceApproved - The user has approved the request, and the application can exchange the device code
+	DeviceApproved DeviceStatus = "approved"
+
+	// DeviceDenied - The user has denied the request
+	DeviceDenied DeviceStatus = "denied"
+)
+
+/*
+DeviceAuthorization - A RFC 8628 device authorization request. The device code is handed to the
+application and only its SHA-256 hash is stored, while the short user code is shown to the user
+so they can approve the request from another device
+*/
+type DeviceAuthorization struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// Hash - The hex encoded SHA-256 hash of the device code
+	Hash string `json:"hash" bson:"hash"`
+
+	// UserCode - The code the user enters on the verification page, without its separator
+	UserCode string `json:"user_code" bson:"user_code"`
+
+	// ClientID - The ClientID of the application that started the request
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	// Audience - The audience of the API the access token is issued for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Scope - The scopes that will be granted if the user approves the request
+	Scope []string `json:"scope" bson:"scope"`
+
+	// Status - Whether the user has approved or denied the request
+	Status DeviceStatus `json:"status" bson:"status"`
+
+	// Subject - The ID of the user that approved the request
+	Subject string `json:"subject" bson:"subject"`
+
+	// AuthTime - The time that the user that approved the request last actively authenticated
+	AuthTime int64 `json:"auth_time" bson:"auth_time"`
+
+	// ConfirmationHash - The hash of the value embedded in the verification page. Prevents the approval from being forged
+	ConfirmationHash string `json:"confirmation_hash" bson:"confirmation_hash"`
+
+	// ConfirmationSubject - The ID of the user the verification page was last shown to
+	ConfirmationSubject string `json:"confirmation_subject" bson:"confirmation_subject"`
+
+	// Used - Set to true once the device code has been exchanged
+	Used bool `json:"used" bson:"used"`
+
+	// Interval - The number of seconds the application must wait between polling requests. Increased on slow_down
+	Interval int `json:"interval" bson:"interval"`
+
+	// LastPolledAt - The last time the application polled the token endpoint
+	LastPolledAt time.Time `json:"last_polled_at" bson:"last_polled_at"`
+
+	// ExpiresAt - The time after which the request can no longer be approved or exchanged. MongoDB removes it after this
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+deviceAttempt - The number of invalid user codes submitted by a single user. User codes are short
+enough to be guessed, so RFC 8628 Section 5.1 recommends limiting how many a user can try
+*/
+type deviceAttempt struct {
+	// Subject - The ID of the user that submitted the codes
+	Subject string `bson:"_id"`
+
+	// Count - The number of invalid codes submitted since the window started
+	Count int `bson:"count"`
+
+	// ExpiresAt - The end of the window. MongoDB removes the document after this, which resets the count
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+/*
+locked - Returns true if the user has reached maxDeviceAttempts within a window that has not yet
+ended. The expiry is checked here as well, as MongoDB only removes expired documents periodically
+*/
+func (attempt *deviceAttempt) locked(now time.Time) bool {
+	return attempt.Count >= maxDeviceAttempts && attempt.ExpiresAt.After(now)
+}
+
+/*
+getDeviceAttempt - Fetch the invalid user codes submitted by the user passed in the subject parameter.
+An empty deviceAttempt is returned if they have not submitted any
+*/
+func getDeviceAttempt(database *server.Database, subject string) (*deviceAttempt, error) {
+	var ret deviceAttempt
+
+	err := database.Find("device_attempt", bson.M{"_id": subject}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return &deviceAttempt{Subject: subject}, nil
+		}
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+/*
+recordDeviceAttempt - Count an invalid user code against the user passed in the subject parameter. If
+their previous window has ended, a new one is started
+*/
+func recordDeviceAttempt(database *server.Database, subject string) error {
+	now := time.Now().UTC()
+
+	var ret deviceAttempt
+
+	err := database.FindAndUpdate(
+		"device_attempt",
+		bson.M{"_id": subject, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$inc": bson.M{"count": 1}},
+		&ret,
+	)
+	if err == nil {
+		return nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	/*
+		The window has ended but MongoDB may not have removed the document yet, so it
+		is removed here before a new window is started. If a concurrent request started
+		the window first, the insert fails with a duplicate key and the count is applied
+		to that window instead
+	*/
+	err = database.Delete("device_attempt", bson.M{"_id": subject, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+
+	err = database.Insert("device_attempt", &deviceAttempt{Subject: subject, Count: 1, ExpiresAt: now.Add(deviceAttemptWindow)})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return database.Update("device_attempt", bson.M{"_id": subject}, bson.M{"$inc": bson.M{"count": 1}})
+		}
+		return err
+	}
+
+	return nil
+}
+
+/*
+newUserCode - Generate a user code using userCodeAlphabet
+*/
+func newUserCode() (string, error) {
+	return rand.FromAlphabet(userCodeAlphabet, userCodeLength)
+}
+
+/*
+normalizeUserCode - Convert the user code typed by a user into the form it is stored in. Case,
+separators and whitespace are ignored
+*/
+func normalizeUserCode(userCode string) string {
+	var ret strings.Builder
+
+	for _, char := range strings.ToUpper(userCode) {
+		if strings.ContainsRune(userCodeAlphabet, char) {
+			ret.WriteRune(char)
+		}
+	}
+
+	return ret.String()
+}
+
+/*
+formatUserCode - Split the user code into two halves so that it is easier to read, for example WDJB-MJHT
+*/
+func formatUserCode(userCode string) string {
+	half := len(userCode) / 2
+	return userCode[:half] + "-" + userCode[half:]
+}
+
+/*
+createDeviceAuthorization - Generate a new device code and user code, and store the request in the
+database. The raw device code and formatted user code are returned, and this is the only time the
+device code is available
+*/
+func createDeviceAuthorization(database *server.Database, device *DeviceAuthorization) (string, string, error) {
+	raw, err := newHandle()
+	if err != nil {
+		return "", "", err
+	}
+
+	meta, err := metadata.New()
+	if err != nil {
+		return "", "", err
+	}
+
+	/*
+		User codes are short, so a pending request with the same code could
+		already exist. A new code is generated until a free one is found
+	*/
+	var userCode string
+	for {
+		userCode, err = newUserCode()
+		if err != nil {
+			return "", "", err
+		}
+
+		exists, err := database.Exists("device_code", bson.M{"user_code": userCode})
+		if err != nil {
+			return "", "", err
+		}
+
+		if !exists {
+			break
+		}
+	}
+
+	device.Metadata = meta
+	device.Hash = hashHandle(raw)
+	device.UserCode = userCode
+	device.Status = DevicePending
+	device.Interval = deviceCodeInterval
+	device.ExpiresAt = time.Now().UTC().Add(deviceCodeLifetime)
+
+	err = database.Insert("device_code", device)
+	if err != nil {
+		return "", "", err
+	}
+
+	return raw, formatUserCode(userCode), nil
+}
+
+/*
+getPendingDeviceAuthorization - Fetch a device authorization request that is still waiting for
+the user using the user code passed in the userCode parameter
+*/
+func getPendingDeviceAuthorization(database *server.Database, userCode string) (*DeviceAuthorization, error) {
+	var ret DeviceAuthorization
+
+	err := database.Find("device_code", bson.M{"user_code": normalizeUserCode(userCode), "status": DevicePending}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDeviceCodeDoesNotExist
+		}
+		return nil, err
+	}
+
+	if ret.ExpiresAt.Before(time.Now().UTC()) {
+		return nil, ErrDeviceCodeDoesNotExist
+	}
+
+	return &ret, nil
+}
+
+/*
+getDeviceAuthorization - Fetch a device authorization request using the raw device code
+*/
+func getDeviceAuthorization(database *server.Database, raw string) (*DeviceAuthorization, error) {
+	var ret DeviceAuthorization
+
+	err := database.Find("device_code", bson.M{"hash": hashHandle(raw)}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrDeviceCodeDoesNotExist
+		}
+		return nil, err
+	}
+
+	return &ret, nil
+}
+
+/*
+setDeviceConfirmation - Generate the confirmation value embedded in the verification page shown to
+the user passed in the subject parameter. Only the most recent confirmation is accepted, and only
+from the same user, so a page loaded by one user cannot be submitted on behalf of another
+*/
+func setDeviceConfirmation(database *server.Database, device *DeviceAuthorization, subject string) (string, error) {
+	confirmation, err := newHandle()
+	if err != nil {
+		return "", err
+	}
+
+	err = database.Update(
+		"device_code",
+		bson.M{"hash": device.Hash, "status": DevicePending},
+		bson.M{"$set": bson.M{"confirmation_hash": hashHandle(confirmation), "confirmation_subject": subject}},
+	)
+	if err != nil {
+		return "", err
+	}
+
+	return confirmation, nil
+}
+
+/*
+completeDeviceAuthorization - Record the decision of the user. The request is only updated if it is
+still pending, so a decision can never be changed once it has been made
+*/
+func completeDeviceAuthorization(database *server.Database, device *DeviceAuthorization, status DeviceStatus, session *Session) error {
+	var ret DeviceAuthorization
+
+	err := database.FindAndUpdate(
+		"device_code",
+		bson.M{"hash": device.Hash, "status": DevicePending},
+		bson.M{"$set": bson.M{
+			"status":    status,
+			"subject":   session.User.Metadata.Id,
+			"auth_time": session.AuthTime.Unix(),
+		}},
+		&ret,
+	)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrDeviceCodeDoesNotExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+/*
+pollDeviceAuthorization - Record that the application polled the token endpoint. Returns true if
+the application polled sooner than its interval allows, in which case the interval is increased
+by 5 seconds as required by RFC 8628 Section 3.5
+*/
+func pollDeviceAuthorization(database *server.Database, device *DeviceAuthorization) (bool, error) {
+	now := time.Now().UTC()
+	tooFast := now.Sub(device.LastPolledAt) < time.Duration(device.Interval)*time.Second
+
+	update := bson.M{"$set": bson.M{"last_polled_at": now}}
+	if tooFast {
+		update["$inc"] = bson.M{"interval": 5}
+	}
+
+	err := database.Update("device_code", bson.M{"hash": device.Hash}, update)
+	if err != nil {
+		return false, err
+	}
+
+	return tooFast, nil
+}
+
+/*
+consumeDeviceAuthorization - Atomically mark an approved device authorization request as used, so
+that the device code can only be exchanged once
+*/
+func consumeDeviceAuthorization(database *server.Database, device *DeviceAuthorization) error {
+	var ret DeviceAuthorization
+
+	err := database.FindAndUpdate(
+		"device_code",
+		bson.M{"hash": device.Hash, "status": DeviceApproved, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+		&ret,
+	)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrDeviceCodeDoesNotExist
+		}
+		return err
+	}
+
+	return nil
+}
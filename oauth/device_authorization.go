@@ -0,0 +1,340 @@
+package oauth
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+/*
+DeviceAuthorizationResponse - A successful RFC 8628 Section 3.2 device authorization response
+*/
+type DeviceAuthorizationResponse struct {
+	// DeviceCode - The code the application polls the token endpoint with
+	DeviceCode string `json:"device_code"`
+
+	// UserCode - The code the user enters on the verification page
+	UserCode string `json:"user_code"`
+
+	// VerificationURI - The URL of the verification page
+	VerificationURI string `json:"verification_uri"`
+
+	// VerificationURIComplete - The URL of the verification page with the user code already filled in
+	VerificationURIComplete string `json:"verification_uri_complete"`
+
+	// ExpiresIn - The number of seconds until the device code expires
+	ExpiresIn int `json:"expires_in"`
+
+	// Interval - The minimum number of seconds the application must wait between polling requests
+	Interval int `json:"interval"`
+}
+
+/*
+DeviceAuthorization - A server.HandlerFunc for the RFC 8628 device authorization endpoint. Should
+be registered under POST /oauth/device/code. Like the authorization endpoint, the openid scope can
+be requested without an audience to get access to the userinfo endpoint
+*/
+func (provider *Provider) DeviceAuthorization(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := provider.authenticateClient(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !app.HasGrantType(application.DeviceCode) {
+			abort(c, errUnauthorizedClient("The application is not allowed to use the device authorization grant"))
+			return
+		}
+
+		requested := scope.Parse(c.PostForm("scope"))
+
+		target, authErr := provider.requestedAPI(service.Database(), c.PostForm("audience"), requested)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		deviceCode, userCode, err := createDeviceAuthorization(service.Database(), &DeviceAuthorization{
+			ClientID: app.ClientID,
+			Audience: target.Audience,
+			Scope:    grantScopes(target, requested),
+		})
+		if err != nil {
+			slog.Error("Failed to create device authorization", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		verificationUri := provider.endpoint("/device")
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, &DeviceAuthorizationResponse{
+			DeviceCode:              deviceCode,
+			UserCode:                userCode,
+			VerificationURI:         verificationUri,
+			VerificationURIComplete: verificationUri + "?" + url.Values{"user_code": {userCode}}.Encode(),
+			ExpiresIn:               int(deviceCodeLifetime.Seconds()),
+			Interval:                deviceCodeInterval,
+		})
+	}
+}
+
+/*
+devicePage - The values rendered into deviceTemplate
+*/
+type devicePage struct {
+	// UserCode - The formatted user code. When empty, the user is asked to enter one
+	UserCode string
+
+	// Application - The name of the application requesting access
+	Application string
+
+	// Scope - The scopes the application is requesting
+	Scope []string
+
+	// Confirmation - The confirmation value that must be submitted with the decision of the user
+	Confirmation string
+
+	// Message - Shown instead of the form once the request has been processed, or if it failed
+	Message string
+}
+
+// deviceTemplate - The verification page shown to users of the device authorization grant
+var deviceTemplate = template.Must(template.New("device").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Device Login</title></head>
+<body>
+{{- if .Message }}
+<p>{{ .Message }}</p>
+{{- else if .Confirmation }}
+<p><strong>{{ .Application }}</strong> is requesting access to your account.</p>
+<p>Confirm that the code below matches the code shown on your device: <strong>{{ .UserCode }}</strong></p>
+{{- if .Scope }}
+<ul>{{ range .Scope }}<li>{{ . }}</li>{{ end }}</ul>
+{{- end }}
+<form method="post">
+<input type="hidden" name="user_code" value="{{ .UserCode }}">
+<input type="hidden" name="confirmation" value="{{ .Confirmation }}">
+<button type="submit" name="action" value="approve">Approve</button>
+<button type="submit" name="action" value="deny">Deny</button>
+</form>
+{{- else }}
+<form method="post">
+<label>Enter the code shown on your device <input type="text" name="user_code" value="{{ .UserCode }}" autocomplete="off" autofocus></label>
+<button type="submit">Continue</button>
+</form>
+{{- end }}
+</body>
+</html>
+`))
+
+/*
+renderDevicePage - Write the verification page to the response
+*/
+func renderDevicePage(c *gin.Context, status int, page *devicePage) {
+	var buf bytes.Buffer
+
+	err := deviceTemplate.Execute(&buf, page)
+	if err != nil {
+		slog.Error("Failed to render device verification page", "err", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Frame-Options", "DENY")
+	c.Data(status, "text/html; charset=utf-8", buf.Bytes())
+}
+
+/*
+deviceSession - Resolve the user that is signed in on the verification page. If no user is signed
+in, they are sent to the LoginURL and nil is returned
+*/
+func (provider *Provider) deviceSession(service *server.Service, c *gin.Context) *Session {
+	session, err := provider.session(service, c)
+	if err != nil {
+		slog.Error("Failed to resolve user session", "err", err)
+		renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+		return nil
+	}
+
+	if session == nil {
+		if provider.LoginURL == "" {
+			renderDevicePage(c, http.StatusUnauthorized, &devicePage{Message: "You must be signed in to approve a device."})
+			return nil
+		}
+
+		provider.redirectLogin(c)
+		return nil
+	}
+
+	return session
+}
+
+/*
+DeviceVerification - A server.HandlerFunc for the verification page of the device authorization grant.
+Should be registered under GET /device. The signed in user enters the user code shown on their device,
+which is filled in for them when they follow the verification_uri_complete. Nothing is written until
+the code is submitted to DeviceDecision
+*/
+func (provider *Provider) DeviceVerification(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		session := provider.deviceSession(service, c)
+		if session == nil {
+			return
+		}
+
+		renderDevicePage(c, http.StatusOK, &devicePage{UserCode: c.Query("user_code")})
+	}
+}
+
+/*
+lookupDevice - Fetch the pending request matching the submitted user code. Every invalid code counts
+against the signed in user, and once they reach maxDeviceAttempts no codes are looked up for them
+until deviceAttemptWindow has passed. If the request cannot be returned, the page is rendered and
+nil is returned
+*/
+func lookupDevice(c *gin.Context, service *server.Service, session *Session) *DeviceAuthorization {
+	attempt, err := getDeviceAttempt(service.Database(), session.User.Metadata.Id)
+	if err != nil {
+		slog.Error("Failed to fetch device verification attempts", "err", err)
+		renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+		return nil
+	}
+
+	if attempt.locked(time.Now().UTC()) {
+		renderDevicePage(c, http.StatusTooManyRequests, &devicePage{Message: "Too many invalid codes were entered, please wait a few minutes and try again."})
+		return nil
+	}
+
+	device, err := getPendingDeviceAuthorization(service.Database(), c.PostForm("user_code"))
+	if err != nil {
+		if errors.Is(err, ErrDeviceCodeDoesNotExist) {
+			err = recordDeviceAttempt(service.Database(), session.User.Metadata.Id)
+			if err != nil {
+				slog.Error("Failed to record device verification attempt", "err", err)
+			}
+
+			renderDevicePage(c, http.StatusNotFound, &devicePage{Message: "The code is invalid or has expired."})
+			return nil
+		}
+
+		slog.Error("Failed to fetch device authorization", "err", err)
+		renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+		return nil
+	}
+
+	return device
+}
+
+/*
+confirmDevice - Look up the request matching the submitted user code, and ask the signed in user to
+confirm it. A single use confirmation value is generated for the user, which must be submitted with
+their decision, so that a decision can only be made by someone who was shown the request
+*/
+func (provider *Provider) confirmDevice(c *gin.Context, service *server.Service, session *Session) {
+	device := lookupDevice(c, service, session)
+	if device == nil {
+		return
+	}
+
+	app, err := application.GetApplicationByClientID(service.Database(), device.ClientID)
+	if err != nil {
+		slog.Error("Failed to fetch application", "client_id", device.ClientID, "err", err)
+		renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+		return
+	}
+
+	confirmation, err := setDeviceConfirmation(service.Database(), device, session.User.Metadata.Id)
+	if err != nil {
+		slog.Error("Failed to update device authorization", "client_id", device.ClientID, "err", err)
+		renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+		return
+	}
+
+	renderDevicePage(c, http.StatusOK, &devicePage{
+		UserCode:     formatUserCode(device.UserCode),
+		Application:  app.Name,
+		Scope:        device.Scope,
+		Confirmation: confirmation,
+	})
+}
+
+/*
+DeviceDecision - A server.HandlerFunc for the forms of the verification page. Should be registered
+under POST /device. A submitted user code is passed to confirmDevice, and the decision of the user
+is recorded once they approve or deny the request. Users can only approve requests from applications
+they have been authorized to use
+*/
+func (provider *Provider) DeviceDecision(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		session := provider.deviceSession(service, c)
+		if session == nil {
+			return
+		}
+
+		if c.PostForm("action") == "" {
+			provider.confirmDevice(c, service, session)
+			return
+		}
+
+		device := lookupDevice(c, service, session)
+		if device == nil {
+			return
+		}
+
+		confirmation := hashHandle(c.PostForm("confirmation"))
+		if device.ConfirmationHash == "" || device.ConfirmationSubject != session.User.Metadata.Id ||
+			subtle.ConstantTimeCompare([]byte(device.ConfirmationHash), []byte(confirmation)) != 1 {
+			renderDevicePage(c, http.StatusForbidden, &devicePage{Message: "The request could not be confirmed, please enter the code again."})
+			return
+		}
+
+		status := DeviceDenied
+		if c.PostForm("action") == "approve" {
+			app, err := application.GetApplicationByClientID(service.Database(), device.ClientID)
+			if err != nil {
+				slog.Error("Failed to fetch application", "client_id", device.ClientID, "err", err)
+				renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+				return
+			}
+
+			if !slices.Contains(session.User.Applications, app.Metadata.Id) {
+				renderDevicePage(c, http.StatusForbidden, &devicePage{Message: "You are not authorized to access this application."})
+				return
+			}
+
+			status = DeviceApproved
+		}
+
+		err := completeDeviceAuthorization(service.Database(), device, status, session)
+		if err != nil {
+			if errors.Is(err, ErrDeviceCodeDoesNotExist) {
+				renderDevicePage(c, http.StatusNotFound, &devicePage{Message: "The code is invalid or has expired."})
+				return
+			}
+
+			slog.Error("Failed to update device authorization", "client_id", device.ClientID, "err", err)
+			renderDevicePage(c, http.StatusInternalServerError, &devicePage{Message: "Something went wrong, please try again."})
+			return
+		}
+
+		if status == DeviceDenied {
+			renderDevicePage(c, http.StatusOK, &devicePage{Message: "The request was denied. You can close this page."})
+			return
+		}
+
+		renderDevicePage(c, http.StatusOK, &devicePage{Message: "Your device has been approved. You can close this page and return to your device."})
+	}
+}
@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+/*
+deviceCode - Handles the device_code grant described in RFC 8628 Section 3.4. Applications poll
+this grant until the user has approved or denied the request, or until the device code expires
+*/
+func (provider *Provider) deviceCode(c *gin.Context, service *server.Service, app *application.Application) (*TokenResponse, *Error) {
+	raw := c.PostForm("device_code")
+	if raw == "" {
+		return nil, errInvalidRequest("The device_code parameter is required")
+	}
+
+	device, err := getDeviceAuthorization(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, ErrDeviceCodeDoesNotExist) {
+			return nil, errInvalidGrant("The device code is invalid")
+		}
+
+		slog.Error("Failed to fetch device authorization", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	if device.ClientID != app.ClientID {
+		return nil, errInvalidGrant("The device code was issued to another application")
+	}
+
+	if device.ExpiresAt.Before(time.Now().UTC()) {
+		return nil, errExpiredToken()
+	}
+
+	tooFast, err := pollDeviceAuthorization(service.Database(), device)
+	if err != nil {
+		slog.Error("Failed to update device authorization", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	if tooFast {
+		return nil, errSlowDown()
+	}
+
+	switch device.Status {
+	case DevicePending:
+		return nil, errAuthorizationPending()
+	case DeviceDenied:
+		return nil, errDeviceAccessDenied()
+	}
+
+	err = consumeDeviceAuthorization(service.Database(), device)
+	if err != nil {
+		if errors.Is(err, ErrDeviceCodeDoesNotExist) {
+			return nil, errInvalidGrant("The device code has already been used")
+		}
+
+		slog.Error("Failed to consume device authorization", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	target, err := provider.resolveAPI(service.Database(), device.Audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidGrant("The API the device code was issued for no longer exists")
+		}
+
+		slog.Error("Failed to fetch API", "audience", device.Audience, "err", err)
+		return nil, errServerError()
+	}
+
+	accessToken, _, err := provider.issueAccessToken(c, service, target, device.Subject, false, app.ClientID, device.Scope, nil)
+	if err != nil {
+		slog.Error("Failed to issue access token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	response := &TokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   target.TokenLifetime,
+		Scope:       scope.Format(device.Scope),
+	}
+
+	if slices.Contains(device.Scope, "openid") {
+		response.IDToken, err = provider.issueIDToken(service.Database(), app.ClientID, device.Subject, device.Scope, device.AuthTime, "", accessToken, "")
+		if err != nil {
+			slog.Error("Failed to issue ID token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+	}
+
+	if app.HasGrantType(application.RefreshToken) {
+		refresh, err := token.NewRefreshToken(app.ClientID, device.Subject, target, device.Scope, device.AuthTime)
+		if err != nil {
+			slog.Error("Failed to build refresh token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+
+		/*
+			Refresh tokens issued to public clients are bound to the key the request
+			was made with, as they are not otherwise tied to the application
+		*/
+		if app.IsPublic() {
+			refresh.Confirmation = confirmation(c)
+		}
+
+		response.RefreshToken, err = token.CreateRefreshToken(service.Database(), refresh)
+		if err != nil {
+			slog.Error("Failed to create refresh token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,30 @@
+package oauth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDeviceAttemptLocked(t *testing.T) {
+	now := time.Now().UTC()
+
+	tests := []struct {
+		name    string
+		attempt *deviceAttempt
+		want    bool
+	}{
+		{name: "no attempts", attempt: &deviceAttempt{}, want: false},
+		{name: "below the limit", attempt: &deviceAttempt{Count: maxDeviceAttempts - 1, ExpiresAt: now.Add(time.Minute)}, want: false},
+		{name: "at the limit", attempt: &deviceAttempt{Count: maxDeviceAttempts, ExpiresAt: now.Add(time.Minute)}, want: true},
+		{name: "above the limit", attempt: &deviceAttempt{Count: maxDeviceAttempts + 3, ExpiresAt: now.Add(time.Minute)}, want: true},
+		{name: "window ended", attempt: &deviceAttempt{Count: maxDeviceAttempts, ExpiresAt: now.Add(-time.Second)}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.attempt.locked(now); got != test.want {
+				t.Fatalf("locked() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
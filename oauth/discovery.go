@@ -0,0 +1,271 @@
+package oauth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"net/http"
+	"slices"
+)
+
+/*
+ServerMetadata - The metadata document describing simple-idp, as defined in RFC 8414 and
+OpenID Connect Discovery 1.0 Section 3. The same document is served for both
+*/
+type ServerMetadata struct {
+	// Issuer - The issuer identifier of simple-idp
+	Issuer string `json:"issuer"`
+
+	// AuthorizationEndpoint - The URL of the authorization endpoint
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+
+	// TokenEndpoint - The URL of the token endpoint
+	TokenEndpoint string `json:"token_endpoint"`
+
+	// IntrospectionEndpoint - The URL of the RFC 7662 introspection endpoint
+	IntrospectionEndpoint string `json:"introspection_endpoint"`
+
+	// IntrospectionEndpointAuthMethodsSupported - The client authentication methods supported by the introspection endpoint
+	IntrospectionEndpointAuthMethodsSupported []application.AuthMethod `json:"introspection_endpoint_auth_methods_supported"`
+
+	// RevocationEndpoint - The URL of the RFC 7009 revocation endpoint
+	RevocationEndpoint string `json:"revocation_endpoint"`
+
+	// RevocationEndpointAuthMethodsSupported - The client authentication methods supported by the revocation endpoint
+	RevocationEndpointAuthMethodsSupported []application.AuthMethod `json:"revocation_endpoint_auth_methods_supported"`
+
+	// PushedAuthorizationRequestEndpoint - The URL of the RFC 9126 pushed authorization request endpoint
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint"`
+
+	// DeviceAuthorizationEndpoint - The URL of the RFC 8628 device authorization endpoint
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint"`
+
+	// RegistrationEndpoint - The URL of the RFC 7591 dynamic client registration endpoint. Omitted if registration is disabled
+	RegistrationEndpoint string `json:"registration_endpoint,omitempty"`
+
+	// UserInfoEndpoint - The URL of the OpenID Connect userinfo endpoint
+	UserInfoEndpoint string `json:"userinfo_endpoint"`
+
+	// JWKSURI - The URL of the JWK Set containing the keys tokens are signed with
+	JWKSURI string `json:"jwks_uri"`
+
+	// ScopesSupported - The scopes that applications can request
+	ScopesSupported []string `json:"scopes_supported"`
+
+	// ResponseTypesSupported - The response types supported by the authorization endpoint
+	ResponseTypesSupported []string `json:"response_types_supported"`
+
+	// ResponseModesSupported - The response modes supported by the authorization endpoint
+	ResponseModesSupported []string `json:"response_modes_supported"`
+
+	// GrantTypesSupported - The grant types supported by the token endpoint
+	GrantTypesSupported []application.GrantType `json:"grant_types_supported"`
+
+	// TokenEndpointAuthMethodsSupported - The client authentication methods supported by the token endpoint
+	TokenEndpointAuthMethodsSupported []application.AuthMethod `json:"token_endpoint_auth_methods_supported"`
+
+	// TokenEndpointAuthSigningAlgValuesSupported - The algorithms client assertions can be signed with
+	TokenEndpointAuthSigningAlgValuesSupported []string `json:"token_endpoint_auth_signing_alg_values_supported"`
+
+	// CodeChallengeMethodsSupported - The PKCE code challenge methods supported by the authorization endpoint
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+
+	// SubjectTypesSupported - The OpenID Connect subject identifier types that are supported
+	SubjectTypesSupported []string `json:"subject_types_supported"`
+
+	// IDTokenSigningAlgValuesSupported - The algorithms ID tokens can be signed with
+	IDTokenSigningAlgValuesSupported []api.TokenType `json:"id_token_signing_alg_values_supported"`
+
+	// ClaimsSupported - The claims that simple-idp can provide about a user
+	ClaimsSupported []string `json:"claims_supported"`
+
+	// AuthorizationResponseIssParameterSupported - True as the iss parameter is included in authorization responses
+	AuthorizationResponseIssParameterSupported bool `json:"authorization_response_iss_parameter_supported"`
+
+	// RequestParameterSupported - Always true, request objects can be passed by value
+	RequestParameterSupported bool `json:"request_parameter_supported"`
+
+	// RequestURIParameterSupported - Always true, request objects can be passed by reference
+	RequestURIParameterSupported bool `json:"request_uri_parameter_supported"`
+
+	// RequireRequestURIRegistration - Always true, the request_uri must be registered with the application
+	RequireRequestURIRegistration bool `json:"require_request_uri_registration"`
+
+	// RequestObjectSigningAlgValuesSupported - The algorithms applications can sign request objects with
+	RequestObjectSigningAlgValuesSupported []string `json:"request_object_signing_alg_values_supported"`
+
+	// TLSClientCertificateBoundAccessTokens - True if the Service is served over TLS, so that applications can request certificate-bound access tokens
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens"`
+
+	// DPoPSigningAlgValuesSupported - The algorithms DPoP proofs can be signed with
+	DPoPSigningAlgValuesSupported []string `json:"dpop_signing_alg_values_supported"`
+}
+
+/*
+Metadata - Build the metadata document for the Provider. Endpoint URLs are derived from the
+issuer, and scopes are read from the scope collection so that the document reflects what
+has actually been configured. Mutual TLS is only advertised if the Service is served over TLS
+*/
+func (provider *Provider) Metadata(service *server.Service) (*ServerMetadata, error) {
+	scopes, err := scope.ListScopes(service.Database())
+	if err != nil {
+		return nil, err
+	}
+
+	scopesSupported := slices.Clone(standardScopes)
+	for _, defined := range scopes {
+		if !slices.Contains(scopesSupported, defined.Name) {
+			scopesSupported = append(scopesSupported, defined.Name)
+		}
+	}
+
+	registrationEndpoint := ""
+	if provider.InitialAccessToken != "" || provider.SoftwareStatementJWKSURI != "" {
+		registrationEndpoint = provider.endpoint("/oauth/register")
+	}
+
+	return &ServerMetadata{
+		Issuer:                provider.Issuer,
+		AuthorizationEndpoint: provider.endpoint("/authorize"),
+		TokenEndpoint:         provider.endpoint("/oauth/token"),
+		IntrospectionEndpoint: provider.endpoint("/oauth/introspect"),
+		IntrospectionEndpointAuthMethodsSupported:  provider.confidentialAuthMethods(service),
+		RevocationEndpoint:                         provider.endpoint("/oauth/revoke"),
+		RevocationEndpointAuthMethodsSupported:     provider.authMethodsSupported(service),
+		PushedAuthorizationRequestEndpoint:         provider.endpoint("/oauth/par"),
+		DeviceAuthorizationEndpoint:                provider.endpoint("/oauth/device/code"),
+		RegistrationEndpoint:                       registrationEndpoint,
+		UserInfoEndpoint:                           provider.endpoint("/userinfo"),
+		JWKSURI:                                    provider.endpoint("/.well-known/jwks.json"),
+		ScopesSupported:                            scopesSupported,
+		ResponseTypesSupported:                     []string{"code"},
+		ResponseModesSupported:                     []string{"query"},
+		GrantTypesSupported:                        provider.grantTypesSupported(),
+		TokenEndpointAuthMethodsSupported:          provider.authMethodsSupported(service),
+		TokenEndpointAuthSigningAlgValuesSupported: provider.assertionAlgorithmsSupported(),
+		CodeChallengeMethodsSupported:              []string{"S256"},
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []api.TokenType{api.RS256},
+		ClaimsSupported: []string{
+			"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce",
+			"name", "preferred_username", "updated_at", "email", "email_verified",
+		},
+		AuthorizationResponseIssParameterSupported: true,
+		RequestParameterSupported:                  true,
+		RequestURIParameterSupported:               true,
+		RequireRequestURIRegistration:              true,
+		RequestObjectSigningAlgValuesSupported:     applicationAlgorithms,
+		TLSClientCertificateBoundAccessTokens:      service.TLSEnabled(),
+		DPoPSigningAlgValuesSupported:              token.DPoPAlgorithms,
+	}, nil
+}
+
+/*
+grantTypesSupported - Returns the grant types the token endpoint can issue tokens for. The grants
+that require a user to sign in, and the refresh tokens issued from them, are only advertised if
+the Provider has an Authenticator, as users are always treated as signed out without one
+*/
+func (provider *Provider) grantTypesSupported() []application.GrantType {
+	var ret []application.GrantType
+
+	for _, grantType := range application.GrantTypes {
+		if provider.Authenticator == nil && requiresSession(grantType) {
+			continue
+		}
+
+		ret = append(ret, grantType)
+	}
+
+	return ret
+}
+
+/*
+requiresSession - Returns true if tokens can only be issued through the grant type passed in the
+grantType parameter after a user has signed in
+*/
+func requiresSession(grantType application.GrantType) bool {
+	switch grantType {
+	case application.AuthorizationCodePKCE, application.DeviceCode, application.RefreshToken:
+		return true
+	}
+
+	return false
+}
+
+/*
+authMethodsSupported - Returns the client authentication methods applications can use with this
+Provider. Public clients can only use grants that require a user to sign in, so the none method
+is left out when none of those grants are supported. The mutual TLS methods are left out unless
+the Service is served over TLS, as no client certificate can be presented otherwise
+*/
+func (provider *Provider) authMethodsSupported(service *server.Service) []application.AuthMethod {
+	var ret []application.AuthMethod
+
+	for _, method := range application.AuthMethods {
+		if method == application.None && provider.Authenticator == nil {
+			continue
+		}
+
+		if (method == application.TLSClientAuth || method == application.SelfSignedTLSClientAuth) && !service.TLSEnabled() {
+			continue
+		}
+
+		if method == application.ClientSecretJWT && !provider.clientSecretJWTEnabled() {
+			continue
+		}
+
+		ret = append(ret, method)
+	}
+
+	return ret
+}
+
+/*
+assertionAlgorithmsSupported - Returns the algorithms client assertions can be signed with. The HMAC
+algorithms are only advertised if client_secret_jwt is enabled
+*/
+func (provider *Provider) assertionAlgorithmsSupported() []string {
+	if !provider.clientSecretJWTEnabled() {
+		return applicationAlgorithms
+	}
+
+	return append(slices.Clone(applicationAlgorithms), hmacAlgorithms...)
+}
+
+/*
+confidentialAuthMethods - Returns the client authentication methods that confidential
+applications can use. Endpoints that public clients cannot call only advertise these
+*/
+func (provider *Provider) confidentialAuthMethods(service *server.Service) []application.AuthMethod {
+	var ret []application.AuthMethod
+
+	for _, method := range provider.authMethodsSupported(service) {
+		if method != application.None {
+			ret = append(ret, method)
+		}
+	}
+
+	return ret
+}
+
+/*
+Discovery - A server.HandlerFunc that serves the metadata document of the Provider. Should be
+registered under both /.well-known/openid-configuration and /.well-known/oauth-authorization-server
+*/
+func (provider *Provider) Discovery(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		metadata, err := provider.Metadata(service)
+		if err != nil {
+			slog.Error("Failed to build server metadata", "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, metadata)
+	}
+}
@@ -0,0 +1,57 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"net/http"
+)
+
+// dpopThumbprintKey - The key of the gin context value holding the thumbprint of the DPoP key a request was made with
+const dpopThumbprintKey = "oauth.dpop_jkt"
+
+/*
+verifyTokenDPoP - Validate the DPoP proof sent to the token endpoint, if any. The thumbprint of
+the key is stored in the gin context, so that the tokens issued for the request are bound to it
+*/
+func (provider *Provider) verifyTokenDPoP(c *gin.Context, service *server.Service) *Error {
+	proof, err := token.DPoPHeader(c.Request)
+	if err != nil {
+		return errInvalidDPoPProof("Only one DPoP proof may be sent")
+	}
+
+	if proof == "" {
+		return nil
+	}
+
+	thumbprint, err := token.VerifyDPoPProof(service.Database(), proof, http.MethodPost, provider.endpoint("/oauth/token"), "", provider.Leeway)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidDPoPProof) || errors.Is(err, token.ErrDPoPProofReplayed) {
+			return errInvalidDPoPProof("The DPoP proof is invalid")
+		}
+
+		slog.Error("Failed to verify DPoP proof", "err", err)
+		return errServerError()
+	}
+
+	c.Set(dpopThumbprintKey, thumbprint)
+
+	return nil
+}
+
+/*
+confirmation - Returns the cnf claim binding a token to the DPoP key or client certificate the
+request was made with. If neither applies, nil is returned and the token is a bearer token
+*/
+func confirmation(c *gin.Context) *token.Confirmation {
+	jkt := c.GetString(dpopThumbprintKey)
+	x5t := c.GetString(certificateThumbprintKey)
+
+	if jkt == "" && x5t == "" {
+		return nil
+	}
+
+	return &token.Confirmation{JWKThumbprint: jkt, CertificateThumbprint: x5t}
+}
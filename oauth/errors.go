@@ -0,0 +1,212 @@
+package oauth
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+/*
+Error - A RFC 6749 Section 5.2 error response. These are returned to clients as JSON
+when a request to one of the OAuth endpoints fails
+*/
+type Error struct {
+	// Code - The error code defined by the RFC, for example invalid_request
+	Code string `json:"error"`
+
+	// Description - A human readable description of what went wrong
+	Description string `json:"error_description,omitempty"`
+
+	// Status - The HTTP status code the error is returned with
+	Status int `json:"-"`
+}
+
+/*
+Error - Returns the error code and description of the error
+*/
+func (err *Error) Error() string {
+	if err.Description == "" {
+		return "oauth: " + err.Code
+	}
+
+	return "oauth: " + err.Code + ": " + err.Description
+}
+
+/*
+errInvalidRequest - The request is missing a parameter, or is otherwise malformed
+*/
+func errInvalidRequest(description string) *Error {
+	return &Error{Code: "invalid_request", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidClient - Client authentication failed
+*/
+func errInvalidClient(description string) *Error {
+	return &Error{Code: "invalid_client", Description: description, Status: http.StatusUnauthorized}
+}
+
+/*
+errInvalidGrant - The provided authorization grant is invalid, expired or revoked
+*/
+func errInvalidGrant(description string) *Error {
+	return &Error{Code: "invalid_grant", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errUnauthorizedClient - The client is not allowed to use the requested grant type
+*/
+func errUnauthorizedClient(description string) *Error {
+	return &Error{Code: "unauthorized_client", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errUnsupportedGrantType - The grant type is not supported by simple-idp
+*/
+func errUnsupportedGrantType(description string) *Error {
+	return &Error{Code: "unsupported_grant_type", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidScope - The requested scope is invalid or unknown
+*/
+func errInvalidScope(description string) *Error {
+	return &Error{Code: "invalid_scope", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidTarget - The requested audience is invalid or unknown, as defined in RFC 8707
+*/
+func errInvalidTarget(description string) *Error {
+	return &Error{Code: "invalid_target", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errUnsupportedResponseType - The response type is not supported by simple-idp
+*/
+func errUnsupportedResponseType(description string) *Error {
+	return &Error{Code: "unsupported_response_type", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidRequestObject - The request object is invalid, as defined in RFC 9101
+*/
+func errInvalidRequestObject(description string) *Error {
+	return &Error{Code: "invalid_request_object", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidRequestURI - The request_uri is invalid, or its request object could not be fetched, as defined in RFC 9101
+*/
+func errInvalidRequestURI(description string) *Error {
+	return &Error{Code: "invalid_request_uri", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidDPoPProof - The DPoP proof sent with the request is invalid, as defined in RFC 9449
+*/
+func errInvalidDPoPProof(description string) *Error {
+	return &Error{Code: "invalid_dpop_proof", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidToken - The access token sent with the request is missing or invalid, as defined in RFC 6750 Section 3.1
+*/
+func errInvalidToken(description string) *Error {
+	return &Error{Code: "invalid_token", Description: description, Status: http.StatusUnauthorized}
+}
+
+/*
+errInvalidRedirectURI - One of the redirect URIs in the client metadata is invalid, as defined in RFC 7591
+*/
+func errInvalidRedirectURI(description string) *Error {
+	return &Error{Code: "invalid_redirect_uri", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidClientMetadata - The client metadata is invalid, as defined in RFC 7591
+*/
+func errInvalidClientMetadata(description string) *Error {
+	return &Error{Code: "invalid_client_metadata", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errInvalidSoftwareStatement - The software statement is invalid, as defined in RFC 7591
+*/
+func errInvalidSoftwareStatement(description string) *Error {
+	return &Error{Code: "invalid_software_statement", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errUnapprovedSoftwareStatement - The software statement is not trusted by simple-idp, as defined in RFC 7591
+*/
+func errUnapprovedSoftwareStatement(description string) *Error {
+	return &Error{Code: "unapproved_software_statement", Description: description, Status: http.StatusBadRequest}
+}
+
+/*
+errAccessDenied - The user or simple-idp denied the request
+*/
+func errAccessDenied(description string) *Error {
+	return &Error{Code: "access_denied", Description: description, Status: http.StatusForbidden}
+}
+
+/*
+errDeviceAccessDenied - The user denied the device authorization request. RFC 8628 Section 3.5 returns this
+from the token endpoint, where every error uses 400 Bad Request
+*/
+func errDeviceAccessDenied() *Error {
+	return &Error{Code: "access_denied", Description: "The user denied the request", Status: http.StatusBadRequest}
+}
+
+/*
+errAuthorizationPending - The user has not yet approved the device authorization request, as defined in RFC 8628
+*/
+func errAuthorizationPending() *Error {
+	return &Error{Code: "authorization_pending", Description: "The user has not yet approved the request", Status: http.StatusBadRequest}
+}
+
+/*
+errSlowDown - The application is polling the token endpoint too quickly, as defined in RFC 8628
+*/
+func errSlowDown() *Error {
+	return &Error{Code: "slow_down", Description: "The polling interval has been increased by 5 seconds", Status: http.StatusBadRequest}
+}
+
+/*
+errExpiredToken - The device code has expired, and the application must start a new request, as defined in RFC 8628
+*/
+func errExpiredToken() *Error {
+	return &Error{Code: "expired_token", Description: "The device code has expired", Status: http.StatusBadRequest}
+}
+
+/*
+errLoginRequired - The user is not signed in, and cannot be prompted to sign in
+*/
+func errLoginRequired() *Error {
+	return &Error{Code: "login_required", Description: "The user is not signed in", Status: http.StatusUnauthorized}
+}
+
+/*
+errServerError - An unexpected error occurred while processing the request
+*/
+func errServerError() *Error {
+	return &Error{Code: "server_error", Status: http.StatusInternalServerError}
+}
+
+/*
+abort - Write the error to the response and stop processing the request. Responses
+containing errors must not be cached, just like successful token responses
+*/
+func abort(c *gin.Context, err *Error) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	switch err.Code {
+	case "invalid_client":
+		c.Header("WWW-Authenticate", `Basic realm="simple-idp"`)
+	case "invalid_token":
+		c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+
+	c.AbortWithStatusJSON(err.Status, err)
+}
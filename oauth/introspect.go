@@ -0,0 +1,265 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// introspectionJWTType - The media type of signed introspection responses, as defined in RFC 9701
+const introspectionJWTType = "token-introspection+jwt"
+
+/*
+IntrospectionResponse - A RFC 7662 Section 2.2 introspection response. Only Active is returned
+for tokens that are expired, revoked, or otherwise invalid
+*/
+type IntrospectionResponse struct {
+	// Active - True if the token is currently valid
+	Active bool `json:"active"`
+
+	// Scope - A space delimited list of the scopes granted to the token
+	Scope string `json:"scope,omitempty"`
+
+	// ClientID - The ClientID of the application the token was issued to
+	ClientID string `json:"client_id,omitempty"`
+
+	// TokenType - Either access_token or refresh_token
+	TokenType string `json:"token_type,omitempty"`
+
+	// Subject - The subject of the token
+	Subject string `json:"sub,omitempty"`
+
+	// Audience - The audience of the token
+	Audience []string `json:"aud,omitempty"`
+
+	// Issuer - The issuer of the token
+	Issuer string `json:"iss,omitempty"`
+
+	// ExpiresAt - The time the token expires, in seconds
+	ExpiresAt int64 `json:"exp,omitempty"`
+
+	// IssuedAt - The time the token was issued, in seconds
+	IssuedAt int64 `json:"iat,omitempty"`
+
+	// ID - The jti of the token. Not present for refresh tokens
+	ID string `json:"jti,omitempty"`
+
+	// Actor - The delegation chain of tokens issued through token exchange
+	Actor *token.Actor `json:"act,omitempty"`
+
+	// Confirmation - The key the token is bound to. Resource servers must check this for sender-constrained tokens
+	Confirmation *token.Confirmation `json:"cnf,omitempty"`
+}
+
+/*
+introspectionClaims - The claims of a signed introspection response, as defined in RFC 9701 Section 5
+*/
+type introspectionClaims struct {
+	jwt.RegisteredClaims
+
+	// TokenIntrospection - The introspection response
+	TokenIntrospection *IntrospectionResponse `json:"token_introspection"`
+}
+
+/*
+Introspect - A server.HandlerFunc for the RFC 7662 introspection endpoint. Should be registered
+under POST /oauth/introspect. Both JWT access tokens and opaque refresh tokens can be introspected.
+Refresh tokens can only be introspected by the application they were issued to, and access tokens by
+the application they were issued to or one of the IntrospectionClients of their API. Anything else is
+reported as inactive, so that applications cannot learn about tokens issued to others.
+If the application sends an Accept header of application/token-introspection+jwt, the response is
+returned as a signed JWT
+*/
+func (provider *Provider) Introspect(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := provider.authenticateClient(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if app.IsPublic() {
+			abort(c, errUnauthorizedClient("Public clients cannot introspect tokens"))
+			return
+		}
+
+		raw := c.PostForm("token")
+		if raw == "" {
+			abort(c, errInvalidRequest("The token parameter is required"))
+			return
+		}
+
+		var response *IntrospectionResponse
+		var err error
+
+		/*
+			The token_type_hint only decides which lookup is attempted first, as
+			RFC 7662 requires the server to fall back to the other token types
+		*/
+		if c.PostForm("token_type_hint") == "refresh_token" {
+			response, err = provider.introspectRefreshToken(service, app, raw)
+			if err == nil && !response.Active {
+				response, err = provider.introspectAccessToken(service, app, raw)
+			}
+		} else {
+			response, err = provider.introspectAccessToken(service, app, raw)
+			if err == nil && !response.Active {
+				response, err = provider.introspectRefreshToken(service, app, raw)
+			}
+		}
+
+		if err != nil {
+			slog.Error("Failed to introspect token", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+
+		if strings.Contains(c.GetHeader("Accept"), "application/"+introspectionJWTType) {
+			signed, err := provider.signIntrospection(service.Database(), app, response)
+			if err != nil {
+				slog.Error("Failed to sign introspection response", "client_id", app.ClientID, "err", err)
+				abort(c, errServerError())
+				return
+			}
+
+			c.Data(http.StatusOK, "application/"+introspectionJWTType, []byte(signed))
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+/*
+introspectAccessToken - Verify a JWT access token against the API it was issued for. Any
+validation error, including revocation, results in an inactive response, as does a token the
+application passed in the app parameter is not allowed to introspect
+*/
+func (provider *Provider) introspectAccessToken(service *server.Service, app *application.Application, raw string) (*IntrospectionResponse, error) {
+	claims, err := provider.verifyAccessToken(service, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims == nil {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	allowed, err := provider.canIntrospect(service.Database(), app, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	if !allowed {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	return &IntrospectionResponse{
+		Active:       true,
+		Scope:        claims.Scope,
+		ClientID:     claims.ClientID,
+		TokenType:    "access_token",
+		Subject:      claims.Subject,
+		Audience:     claims.Audience,
+		Issuer:       claims.Issuer,
+		ExpiresAt:    claims.ExpiresAt.Unix(),
+		IssuedAt:     claims.IssuedAt.Unix(),
+		ID:           claims.ID,
+		Actor:        claims.Actor,
+		Confirmation: claims.Confirmation,
+	}, nil
+}
+
+/*
+canIntrospect - Returns true if the application passed in the app parameter may introspect the access
+token. Applications can introspect the tokens issued to them, and the tokens issued for any API that
+lists them in its IntrospectionClients
+*/
+func (provider *Provider) canIntrospect(database *server.Database, app *application.Application, claims *token.Claims) (bool, error) {
+	if claims.ClientID == app.ClientID {
+		return true, nil
+	}
+
+	for _, audience := range claims.Audience {
+		target, err := provider.resolveAPI(database, audience)
+		if err != nil {
+			if errors.Is(err, api.ErrAPIDoesNotExist) {
+				continue
+			}
+			return false, err
+		}
+
+		if slices.Contains(target.IntrospectionClients, app.ClientID) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+/*
+introspectRefreshToken - Look up an opaque refresh token. Refresh tokens that have been rotated,
+revoked or have expired result in an inactive response, as do refresh tokens that were issued to
+an application other than the one passed in the app parameter
+*/
+func (provider *Provider) introspectRefreshToken(service *server.Service, app *application.Application, raw string) (*IntrospectionResponse, error) {
+	refresh, err := token.GetRefreshToken(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, token.ErrRefreshTokenDoesNotExist) {
+			return &IntrospectionResponse{Active: false}, nil
+		}
+		return nil, err
+	}
+
+	if !refresh.IsActive() || refresh.ClientID != app.ClientID {
+		return &IntrospectionResponse{Active: false}, nil
+	}
+
+	return &IntrospectionResponse{
+		Active:       true,
+		Scope:        scope.Format(refresh.Scope),
+		ClientID:     refresh.ClientID,
+		TokenType:    "refresh_token",
+		Subject:      refresh.Subject,
+		Audience:     []string{refresh.Audience},
+		Issuer:       provider.Issuer,
+		ExpiresAt:    refresh.ExpiresAt.Unix(),
+		IssuedAt:     time.Unix(0, refresh.Metadata.CreationDate).Unix(),
+		Confirmation: refresh.Confirmation,
+	}, nil
+}
+
+/*
+signIntrospection - Wrap the introspection response in a JWT signed by simple-idp, as defined in
+RFC 9701. The response is signed with the active RS256 key, the same key ID tokens are signed with
+*/
+func (provider *Provider) signIntrospection(database *server.Database, app *application.Application, response *IntrospectionResponse) (string, error) {
+	signingKey, err := key.GetSigningKey(database, api.RS256)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &introspectionClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:   provider.Issuer,
+			Audience: jwt.ClaimStrings{app.ClientID},
+			IssuedAt: jwt.NewNumericDate(time.Now().UTC()),
+		},
+		TokenIntrospection: response,
+	}
+
+	return token.SignWithType(claims, signingKey, introspectionJWTType)
+}
@@ -0,0 +1,76 @@
+package oauth
+
+import (
+	"crypto/x509"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+)
+
+// certificateThumbprintKey - The key of the gin context value holding the thumbprint of the client certificate tokens are bound to
+const certificateThumbprintKey = "oauth.x5t_s256"
+
+/*
+authenticateCertificate - Authenticate an application using the client certificate it presented
+during the TLS handshake, as described in RFC 8705 Section 2. With tls_client_auth the certificate
+must chain to one of the certificate authorities trusted by the Service, and match the subject DN
+or SAN registered with the application. With self_signed_tls_client_auth the certificate must be
+registered in the JWKS of the application
+*/
+func authenticateCertificate(c *gin.Context, service *server.Service, app *application.Application) *Error {
+	cert := server.ClientCertificate(c)
+	if cert == nil {
+		return errInvalidClient("A client certificate is required")
+	}
+
+	if app.TokenEndpointAuthMethod == application.SelfSignedTLSClientAuth {
+		ok, err := app.HasCertificate(cert)
+		if err != nil {
+			slog.Warn("Failed to fetch application certificates", "client_id", app.ClientID, "err", err)
+			return errInvalidClient("Client authentication failed")
+		}
+
+		if !ok {
+			return errInvalidClient("Client authentication failed")
+		}
+
+		return nil
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range c.Request.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(intermediate)
+	}
+
+	_, err := cert.Verify(x509.VerifyOptions{
+		Roots:         service.ClientCAs(),
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil || !app.MatchesCertificate(cert) {
+		return errInvalidClient("Client authentication failed")
+	}
+
+	return nil
+}
+
+/*
+bindCertificate - If the application requires certificate-bound access tokens, store the thumbprint
+of its client certificate in the gin context so that the tokens issued for the request are bound to it
+*/
+func bindCertificate(c *gin.Context, app *application.Application) *Error {
+	if !app.TLSClientCertificateBoundAccessTokens {
+		return nil
+	}
+
+	cert := server.ClientCertificate(c)
+	if cert == nil {
+		return errInvalidRequest("The application requires certificate-bound tokens, but no client certificate was presented")
+	}
+
+	c.Set(certificateThumbprintKey, token.CertificateThumbprint(cert))
+
+	return nil
+}
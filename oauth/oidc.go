@@ -0,0 +1,134 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"slices"
+	"time"
+)
+
+// ErrNoIDTokenKey - Gets returned when an ID token is requested, but no RS256 key is active
+var ErrNoIDTokenKey = errors.New("oauth: An active RS256 key is required to issue ID tokens")
+
+// idTokenLifetime - How long an ID token is valid for after it was issued
+const idTokenLifetime = time.Hour
+
+// userinfoAlgorithms - The algorithms of access tokens that can be used at the userinfo endpoint. HS256 is excluded,
+// as the signing secret is shared with the API, which could then mint tokens for the userinfo of any user
+var userinfoAlgorithms = []api.TokenType{api.RS256, api.ES256, api.EdDSA}
+
+// standardScopes - The OpenID Connect scopes that are understood by simple-idp, in addition to the permissions of each API
+var standardScopes = []string{"openid", "profile", "email"}
+
+/*
+grantScopes - Returns the scopes passed in the requested parameter that can be granted for the API
+passed in the target parameter. This includes the OpenID Connect scopes, and any permissions
+defined by the API
+*/
+func grantScopes(target *api.API, requested []string) []string {
+	var ret []string
+
+	for _, name := range requested {
+		if slices.Contains(standardScopes, name) || target.HasPermission(name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret
+}
+
+/*
+userinfoAudience - The audience of access tokens that can be used at the userinfo endpoint
+*/
+func (provider *Provider) userinfoAudience() string {
+	return provider.endpoint("/userinfo")
+}
+
+/*
+userinfoAPI - Returns the built-in API that represents the userinfo endpoint. This is used when
+an application only requests OpenID Connect scopes and does not provide an audience
+*/
+func (provider *Provider) userinfoAPI() *api.API {
+	return &api.API{
+		Name:          "userinfo",
+		Audience:      provider.userinfoAudience(),
+		TokenType:     api.RS256,
+		TokenLifetime: 86400,
+	}
+}
+
+/*
+userinfoAPIFor - Returns the built-in userinfo API for the access token passed in the raw parameter.
+Access tokens are signed with the algorithm of the API they were issued for, so the returned API uses
+the algorithm of the token if it is one of userinfoAlgorithms, and RS256 otherwise
+*/
+func (provider *Provider) userinfoAPIFor(raw string) *api.API {
+	target := provider.userinfoAPI()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(raw, &jwt.RegisteredClaims{})
+	if err != nil {
+		return target
+	}
+
+	algorithm := api.TokenType(parsed.Method.Alg())
+	if slices.Contains(userinfoAlgorithms, algorithm) {
+		target.TokenType = algorithm
+	}
+
+	return target
+}
+
+/*
+resolveAPI - Fetch an API using its audience identifier. The audience of the userinfo endpoint
+resolves to the built-in API returned by userinfoAPI
+*/
+func (provider *Provider) resolveAPI(database *server.Database, audience string) (*api.API, error) {
+	if audience == provider.userinfoAudience() {
+		return provider.userinfoAPI(), nil
+	}
+
+	return api.GetAPIByAudience(database, audience)
+}
+
+/*
+issueIDToken - Build and sign an ID token for the user passed in the subject parameter. ID tokens
+are always signed with the active RS256 key, as required by OpenID Connect Core Section 15.1. The
+code parameter should be empty unless the ID token is issued in exchange for an authorization code
+*/
+func (provider *Provider) issueIDToken(database *server.Database, clientId string, subject string, scopes []string, authTime int64, nonce string, accessToken string, code string) (string, error) {
+	usr, err := user.GetUserByID(database, subject, true)
+	if err != nil {
+		return "", err
+	}
+
+	signingKey, err := key.GetSigningKey(database, api.RS256)
+	if err != nil {
+		if errors.Is(err, key.ErrKeyDoesNotExist) {
+			return "", ErrNoIDTokenKey
+		}
+		return "", err
+	}
+
+	claims, err := token.NewIDClaims(provider.Issuer, clientId, usr, scopes, idTokenLifetime)
+	if err != nil {
+		return "", err
+	}
+
+	claims.Nonce = nonce
+	claims.AccessTokenHash = token.HalfHash(accessToken, signingKey.Algorithm)
+
+	if authTime != 0 {
+		claims.AuthTime = jwt.NewNumericDate(time.Unix(authTime, 0))
+	}
+
+	if code != "" {
+		claims.CodeHash = token.HalfHash(code, signingKey.Algorithm)
+	}
+
+	return token.Sign(claims, signingKey)
+}
@@ -0,0 +1,66 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"testing"
+)
+
+func TestUserinfoAPIFor(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		signed, err := jwt.NewWithClaims(method, jwt.RegisteredClaims{Subject: "user-1"}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	tests := []struct {
+		name string
+		raw  string
+		want api.TokenType
+	}{
+		{name: "RS256", raw: sign(jwt.SigningMethodRS256, rsaKey), want: api.RS256},
+		{name: "ES256", raw: sign(jwt.SigningMethodES256, ecdsaKey), want: api.ES256},
+		{name: "EdDSA", raw: sign(jwt.SigningMethodEdDSA, ed25519Key), want: api.EdDSA},
+		{name: "HS256 is not accepted", raw: sign(jwt.SigningMethodHS256, []byte("secret")), want: api.RS256},
+		{name: "malformed", raw: "not-a-token", want: api.RS256},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			target := provider.userinfoAPIFor(test.raw)
+
+			if target.TokenType != test.want {
+				t.Fatalf("TokenType = %s, want %s", target.TokenType, test.want)
+			}
+
+			if target.Audience != provider.userinfoAudience() {
+				t.Fatalf("Audience = %s, want the userinfo audience", target.Audience)
+			}
+		})
+	}
+}
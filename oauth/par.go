@@ -0,0 +1,244 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrPushedRequestDoesNotExist - Gets returned when a request_uri does not exist, has expired or has already been used
+var ErrPushedRequestDoesNotExist = errors.New("oauth: Pushed authorization request does not exist")
+
+// pushedRequestLifetime - How long a request_uri can be used for after it was issued
+const pushedRequestLifetime = time.Minute
+
+// requestURIPrefix - The prefix of every request_uri, as recommended by RFC 9126 Section 2.2
+const requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+
+// clientAuthParameters - Form parameters used for client authentication. These are never stored with a pushed request
+var clientAuthParameters = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+/*
+PushedRequest - An authorization request that was pushed to the PAR endpoint, as defined in
+RFC 9126. Only the SHA-256 hash of the request_uri is stored
+*/
+type PushedRequest struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// Hash - The hex encoded SHA-256 hash of the request_uri
+	Hash string `json:"hash" bson:"hash"`
+
+	// ClientID - The ClientID of the application that pushed the request
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	// Parameters - The parameters of the authorization request
+	Parameters map[string][]string `json:"parameters" bson:"parameters"`
+
+	// Used - Set to true once an authorization code has been issued for the request
+	Used bool `json:"used" bson:"used"`
+
+	// ExpiresAt - The time after which the request_uri can no longer be used. MongoDB removes the request after this
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+PushedAuthorizationResponse - A successful RFC 9126 Section 2.2 response
+*/
+type PushedAuthorizationResponse struct {
+	// RequestURI - The reference to the pushed request, passed to the authorization endpoint
+	RequestURI string `json:"request_uri"`
+
+	// ExpiresIn - The number of seconds until the request_uri expires
+	ExpiresIn int `json:"expires_in"`
+}
+
+/*
+PushedAuthorization - A server.HandlerFunc for the RFC 9126 pushed authorization request endpoint.
+Should be registered under POST /oauth/par. The request is validated the same way the authorization
+endpoint would validate it, and errors are returned directly to the application
+*/
+func (provider *Provider) PushedAuthorization(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := provider.authenticateClient(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		err := c.Request.ParseForm()
+		if err != nil {
+			abort(c, errInvalidRequest("Malformed request parameters"))
+			return
+		}
+
+		params := url.Values{}
+		for name, values := range c.Request.PostForm {
+			params[name] = values
+		}
+
+		for _, name := range clientAuthParameters {
+			params.Del(name)
+		}
+
+		if params.Get("request_uri") != "" {
+			abort(c, errInvalidRequest("The request_uri parameter cannot be pushed"))
+			return
+		}
+
+		/*
+			Applications authenticating with HTTP Basic may omit the client_id, so
+			the authenticated application is recorded with the request
+		*/
+		if params.Get("client_id") != "" && params.Get("client_id") != app.ClientID {
+			abort(c, errInvalidRequest("The client_id does not match the authenticated application"))
+			return
+		}
+		params.Set("client_id", app.ClientID)
+
+		params, authErr = provider.expandRequestObject(service.Database(), params)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		request := newAuthorizationRequest(params)
+
+		_, authErr = resolveAuthorizationClient(service.Database(), request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		_, authErr = provider.validateAuthorizationRequest(service.Database(), app, request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		requestUri, err := createPushedRequest(service.Database(), &PushedRequest{
+			ClientID:   app.ClientID,
+			Parameters: params,
+		})
+		if err != nil {
+			slog.Error("Failed to create pushed authorization request", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, &PushedAuthorizationResponse{
+			RequestURI: requestUri,
+			ExpiresIn:  int(pushedRequestLifetime.Seconds()),
+		})
+	}
+}
+
+/*
+createPushedRequest - Generate a new request_uri and store the pushed request in the database. The
+request_uri is returned, and is the only time it is available
+*/
+func createPushedRequest(database *server.Database, pushed *PushedRequest) (string, error) {
+	raw, err := newHandle()
+	if err != nil {
+		return "", err
+	}
+
+	meta, err := metadata.New()
+	if err != nil {
+		return "", err
+	}
+
+	pushed.Metadata = meta
+	pushed.Hash = hashHandle(raw)
+	pushed.ExpiresAt = time.Now().UTC().Add(pushedRequestLifetime)
+
+	err = database.Insert("pushed_request", pushed)
+	if err != nil {
+		return "", err
+	}
+
+	return requestURIPrefix + raw, nil
+}
+
+/*
+getPushedRequest - Fetch a pushed request that has not been used or expired, using the request_uri
+passed in the requestUri parameter
+*/
+func getPushedRequest(database *server.Database, requestUri string) (*PushedRequest, error) {
+	raw, ok := strings.CutPrefix(requestUri, requestURIPrefix)
+	if !ok {
+		return nil, ErrPushedRequestDoesNotExist
+	}
+
+	var ret PushedRequest
+
+	err := database.Find("pushed_request", bson.M{"hash": hashHandle(raw), "used": false}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrPushedRequestDoesNotExist
+		}
+		return nil, err
+	}
+
+	if ret.ExpiresAt.Before(time.Now().UTC()) {
+		return nil, ErrPushedRequestDoesNotExist
+	}
+
+	return &ret, nil
+}
+
+/*
+consumePushedRequest - Atomically mark a pushed request as used. This happens when the authorization
+code is issued rather than when the request_uri is first seen, so the user can still be sent through
+the login UI and return to the same request_uri
+*/
+func consumePushedRequest(database *server.Database, pushed *PushedRequest) error {
+	var ret PushedRequest
+
+	err := database.FindAndUpdate(
+		"pushed_request",
+		bson.M{"hash": pushed.Hash, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+		&ret,
+	)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return ErrPushedRequestDoesNotExist
+		}
+		return err
+	}
+
+	return nil
+}
+
+/*
+resolvePushedRequest - Fetch the pushed request referenced by the request_uri parameter of an
+authorization request. The client_id must be repeated, and must match the application that
+pushed the request
+*/
+func resolvePushedRequest(database *server.Database, values url.Values) (*PushedRequest, *Error) {
+	pushed, err := getPushedRequest(database, values.Get("request_uri"))
+	if err != nil {
+		if errors.Is(err, ErrPushedRequestDoesNotExist) {
+			return nil, errInvalidRequest("The request_uri is invalid or has expired")
+		}
+
+		slog.Error("Failed to fetch pushed authorization request", "err", err)
+		return nil, errServerError()
+	}
+
+	if values.Get("client_id") != pushed.ClientID {
+		return nil, errInvalidRequest("The client_id does not match the pushed authorization request")
+	}
+
+	return pushed, nil
+}
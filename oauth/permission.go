@@ -0,0 +1,64 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/permission"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"slices"
+)
+
+// permissionResolverKey - The key of the gin context value holding the permission.Resolver of a request
+const permissionResolverKey = "oauth.permission_resolver"
+
+/*
+permissionResolver - Returns the permission.Resolver of the request, creating it on first use so that
+roles are only loaded once per request
+*/
+func permissionResolver(c *gin.Context, database *server.Database) *permission.Resolver {
+	if value, ok := c.Get(permissionResolverKey); ok {
+		return value.(*permission.Resolver)
+	}
+
+	resolver := permission.NewResolver(database)
+	c.Set(permissionResolverKey, resolver)
+
+	return resolver
+}
+
+/*
+permissions - Returns the value of the permissions claim for a token issued to the subject passed in
+the subject parameter. Users receive the permissions assigned to them directly and through their roles,
+limited to the scopes passed in the scopes parameter. If client is true, the subject is an application
+authenticating as itself, and receives the permissions of the API it was granted scopes for
+*/
+func permissions(c *gin.Context, service *server.Service, target *api.API, subject string, client bool, scopes []string) ([]string, error) {
+	if client {
+		return target.FilterPermissions(scopes), nil
+	}
+
+	usr, err := user.GetUserByID(service.Database(), subject, true)
+	if err != nil {
+		if errors.Is(err, user.ErrUserDoesNotExist) {
+			return []string{}, nil
+		}
+
+		return nil, err
+	}
+
+	resolved, err := permissionResolver(c, service.Database()).Resolve(usr, target)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []string{}
+	for _, name := range resolved {
+		if slices.Contains(scopes, name) {
+			ret = append(ret, name)
+		}
+	}
+
+	return ret, nil
+}
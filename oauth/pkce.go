@@ -0,0 +1,34 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"regexp"
+)
+
+// pkceValue - The character set and length allowed for code verifiers and S256 code challenges by RFC 7636
+var pkceValue = regexp.MustCompile(`^[A-Za-z0-9\-._~]{43,128}$`)
+
+/*
+validCodeChallenge - Returns true if the code challenge is a well-formed S256 challenge. A
+SHA-256 digest always encodes to 43 characters of unpadded base64url
+*/
+func validCodeChallenge(challenge string) bool {
+	return len(challenge) == 43 && pkceValue.MatchString(challenge)
+}
+
+/*
+verifyCodeVerifier - Returns true if the code verifier sent to the token endpoint hashes to the
+code challenge that was sent to the authorization endpoint, as defined in RFC 7636 Section 4.6
+*/
+func verifyCodeVerifier(verifier string, challenge string) bool {
+	if !pkceValue.MatchString(verifier) {
+		return false
+	}
+
+	digest := sha256.Sum256([]byte(verifier))
+	computed := base64.RawURLEncoding.EncodeToString(digest[:])
+
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
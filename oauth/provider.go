@@ -0,0 +1,208 @@
+package oauth
+
+import (
+	"encoding/base64"
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+/*
+Provider - An OAuth 2.0 authorization server. Each endpoint is exposed as a method that
+satisfies server.HandlerFunc, so they can be registered individually with
+Service.RegisterEndpoint, or all at once with Provider.Register
+*/
+type Provider struct {
+	// Issuer - The issuer identifier of simple-idp. Sent in the iss claim of every token
+	Issuer string
+
+	// Leeway - The amount of clock skew that is tolerated when validating tokens
+	Leeway time.Duration
+
+	// RevocationCacheTTL - How long a jti that was found to not be revoked is trusted before the deny list is checked again
+	RevocationCacheTTL time.Duration
+
+	// Authenticator - Resolves the user that is signed in when a request reaches the authorization endpoint
+	Authenticator Authenticator
+
+	// LoginURL - Where users are sent to sign in. The authorization request is passed in the return_to parameter
+	LoginURL string
+
+	// InitialAccessToken - The bearer token that authorizes dynamic client registration. Registration with a token is disabled if empty
+	InitialAccessToken string
+
+	// SoftwareStatementJWKSURI - Where the keys trusted to sign software statements are served. Software statements are rejected if empty
+	SoftwareStatementJWKSURI string
+
+	// HashingParameters - The argon2id parameters used to hash the secrets of dynamically registered applications
+	HashingParameters *user.HashingParameters
+
+	// ClientSecretEncryptionKey - The AES-256 key that the secrets of applications using client_secret_jwt are sealed with. client_secret_jwt is disabled if empty
+	ClientSecretEncryptionKey []byte
+}
+
+/*
+NewProvider - A constructor for the Provider structure
+*/
+func NewProvider(issuer string, leeway time.Duration, authenticator Authenticator, loginUrl string) *Provider {
+	return &Provider{
+		Issuer:             issuer,
+		Leeway:             leeway,
+		RevocationCacheTTL: token.DefaultRevocationCacheTTL,
+		Authenticator:      authenticator,
+		LoginURL:           loginUrl,
+	}
+}
+
+/*
+NewProviderFromConfig - A wrapper around NewProvider that fills in parameters from Viper. The
+leeway and the TTL of the revocation cache are expected to be provided in seconds, and the client
+secret encryption key as base64
+*/
+func NewProviderFromConfig(authenticator Authenticator) *Provider {
+	provider := NewProvider(
+		viper.GetString("token.issuer"),
+		time.Duration(viper.GetInt("token.leeway"))*time.Second,
+		authenticator,
+		viper.GetString("oauth.login_url"),
+	)
+
+	if viper.IsSet("token.revocation_cache_ttl") {
+		provider.RevocationCacheTTL = time.Duration(viper.GetInt("token.revocation_cache_ttl")) * time.Second
+	}
+
+	provider.InitialAccessToken = viper.GetString("oauth.registration.initial_access_token")
+	provider.SoftwareStatementJWKSURI = viper.GetString("oauth.registration.software_statement_jwks_uri")
+	provider.HashingParameters = user.NewHashingParametersFromConfig()
+
+	if viper.IsSet("oauth.client_secret_encryption_key") {
+		encryptionKey, err := base64.StdEncoding.DecodeString(viper.GetString("oauth.client_secret_encryption_key"))
+		if err != nil || len(encryptionKey) != 32 {
+			slog.Error("Ignoring oauth.client_secret_encryption_key, it must be 32 bytes encoded as base64")
+		} else {
+			provider.ClientSecretEncryptionKey = encryptionKey
+		}
+	}
+
+	return provider
+}
+
+/*
+Register - Register every endpoint exposed by the Provider with the service, and create the
+indexes that the Provider depends on
+*/
+func (provider *Provider) Register(service *server.Service) error {
+	err := service.Database().CreateTTLIndex("authorization_code", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("revoked_token", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("refresh_token", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("device_code", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("device_attempt", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("pushed_request", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("dpop_proof", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("client_assertion", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	err = service.Database().CreateTTLIndex("request_object", "expires_at")
+	if err != nil {
+		return err
+	}
+
+	service.RegisterEndpoint(http.MethodGet, "/authorize", provider.Authorize)
+	service.RegisterEndpoint(http.MethodPost, "/authorize", provider.Authorize)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/token", provider.Token)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/par", provider.PushedAuthorization)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/introspect", provider.Introspect)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/revoke", provider.Revoke)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/register", provider.RegisterClient)
+	service.RegisterEndpoint(http.MethodGet, "/oauth/register/:client_id", provider.ReadRegistration)
+	service.RegisterEndpoint(http.MethodPut, "/oauth/register/:client_id", provider.UpdateRegistration)
+	service.RegisterEndpoint(http.MethodDelete, "/oauth/register/:client_id", provider.DeleteRegistration)
+	service.RegisterEndpoint(http.MethodPost, "/oauth/device/code", provider.DeviceAuthorization)
+	service.RegisterEndpoint(http.MethodGet, "/device", provider.DeviceVerification)
+	service.RegisterEndpoint(http.MethodPost, "/device", provider.DeviceDecision)
+	service.RegisterEndpoint(http.MethodGet, "/userinfo", provider.UserInfo)
+	service.RegisterEndpoint(http.MethodPost, "/userinfo", provider.UserInfo)
+	service.RegisterEndpoint(http.MethodGet, "/.well-known/jwks.json", key.JWKSEndpoint)
+	service.RegisterEndpoint(http.MethodGet, "/.well-known/openid-configuration", provider.Discovery)
+	service.RegisterEndpoint(http.MethodGet, "/.well-known/oauth-authorization-server", provider.Discovery)
+
+	return nil
+}
+
+/*
+session - Resolve the user that is signed in using the Authenticator. If no Authenticator
+has been configured, users are always treated as signed out
+*/
+func (provider *Provider) session(service *server.Service, c *gin.Context) (*Session, error) {
+	if provider.Authenticator == nil {
+		return nil, nil
+	}
+
+	return provider.Authenticator(service, c)
+}
+
+/*
+verifier - Build a token.Verifier that validates tokens issued by this Provider
+*/
+func (provider *Provider) verifier(service *server.Service) *token.Verifier {
+	verifier := token.NewVerifier(service.Database(), provider.Issuer, provider.Leeway)
+	verifier.RevocationCacheTTL = provider.RevocationCacheTTL
+
+	return verifier
+}
+
+/*
+hashingParameters - Returns the HashingParameters of the Provider, falling back to the argon2id
+parameters in the configuration if none were set
+*/
+func (provider *Provider) hashingParameters() *user.HashingParameters {
+	if provider.HashingParameters == nil {
+		return user.NewHashingParametersFromConfig()
+	}
+
+	return provider.HashingParameters
+}
+
+/*
+endpoint - Build the absolute URL of an endpoint exposed by the Provider from its issuer
+*/
+func (provider *Provider) endpoint(path string) string {
+	return strings.TrimSuffix(provider.Issuer, "/") + path
+}
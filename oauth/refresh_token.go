@@ -0,0 +1,125 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"slices"
+)
+
+/*
+refreshToken - Handles the refresh_token grant described in RFC 6749 Section 6. The refresh token
+is rotated on every use, so the response always contains a new refresh token. The scope parameter
+can be used to request an access token with fewer scopes than were originally granted
+*/
+func (provider *Provider) refreshToken(c *gin.Context, service *server.Service, app *application.Application) (*TokenResponse, *Error) {
+	raw := c.PostForm("refresh_token")
+	if raw == "" {
+		return nil, errInvalidRequest("The refresh_token parameter is required")
+	}
+
+	/*
+		The binding is checked before the refresh token is consumed, otherwise a
+		stolen refresh token could be used to invalidate the family without the key
+	*/
+	bound, err := token.GetRefreshToken(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, token.ErrRefreshTokenDoesNotExist) {
+			return nil, errInvalidGrant("The refresh token is invalid or has expired")
+		}
+
+		slog.Error("Failed to fetch refresh token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	if !bound.Confirmation.Matches(confirmation(c)) {
+		return nil, errInvalidGrant("The refresh token is bound to a key that was not presented with the request")
+	}
+
+	refresh, err := token.ConsumeRefreshToken(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, token.ErrRefreshTokenDoesNotExist) || errors.Is(err, token.ErrRefreshTokenReused) {
+			return nil, errInvalidGrant("The refresh token is invalid or has expired")
+		}
+
+		slog.Error("Failed to consume refresh token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	/*
+		A refresh token presented by an application other than the one it was issued
+		to has been stolen, so the family is revoked just like it would be on reuse
+	*/
+	if refresh.ClientID != app.ClientID {
+		err = token.RevokeRefreshTokenFamily(service.Database(), refresh.FamilyID)
+		if err != nil {
+			slog.Error("Failed to revoke refresh token family", "family_id", refresh.FamilyID, "err", err)
+		}
+
+		return nil, errInvalidGrant("The refresh token was issued to another application")
+	}
+
+	scopes := refresh.Scope
+
+	requested := scope.Parse(c.PostForm("scope"))
+	if len(requested) != 0 {
+		for _, name := range requested {
+			if !slices.Contains(refresh.Scope, name) {
+				return nil, errInvalidScope("The requested scope exceeds the scope originally granted")
+			}
+		}
+
+		scopes = requested
+	}
+
+	target, err := provider.resolveAPI(service.Database(), refresh.Audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidGrant("The API the refresh token was issued for no longer exists")
+		}
+
+		slog.Error("Failed to fetch API", "audience", refresh.Audience, "err", err)
+		return nil, errServerError()
+	}
+
+	accessToken, _, err := provider.issueAccessToken(c, service, target, refresh.Subject, false, app.ClientID, scopes, nil)
+	if err != nil {
+		slog.Error("Failed to issue access token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	successor, err := refresh.Rotate(target, refresh.Scope)
+	if err != nil {
+		slog.Error("Failed to rotate refresh token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	rawSuccessor, err := token.CreateRefreshToken(service.Database(), successor)
+	if err != nil {
+		slog.Error("Failed to create refresh token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	response := &TokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    target.TokenLifetime,
+		RefreshToken: rawSuccessor,
+		Scope:        scope.Format(scopes),
+	}
+
+	if slices.Contains(scopes, "openid") {
+		response.IDToken, err = provider.issueIDToken(service.Database(), app.ClientID, refresh.Subject, scopes, refresh.AuthTime, "", accessToken, "")
+		if err != nil {
+			slog.Error("Failed to issue ID token", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+	}
+
+	return response, nil
+}
@@ -0,0 +1,588 @@
+package oauth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/grant"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ErrNoSoftwareStatementKey - Gets returned when a software statement is signed with a key that is not trusted
+var ErrNoSoftwareStatementKey = errors.New("oauth: Software statement signing key is not trusted")
+
+/*
+ClientMetadata - The client metadata an application can register with, as defined in RFC 7591
+Section 2. Fields that are not listed here, such as the token exchange policy, can only be
+changed by an administrator
+*/
+type ClientMetadata struct {
+	// ClientName - A human readable name for the application
+	ClientName string `json:"client_name,omitempty"`
+
+	// RedirectURIs - The URIs that users can be redirected back to after authorizing the application
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+
+	// PostLogoutRedirectURIs - The URIs that users can be redirected back to after signing out
+	PostLogoutRedirectURIs []string `json:"post_logout_redirect_uris,omitempty"`
+
+	// ClientType - The kind of application being registered. Inferred from the grant types and auth method if omitted
+	ClientType application.Type `json:"client_type,omitempty"`
+
+	// GrantTypes - The grant types the application will use. Defaults to the grant types of its type
+	GrantTypes []application.GrantType `json:"grant_types,omitempty"`
+
+	// TokenEndpointAuthMethod - How the application authenticates at the token endpoint. Defaults to none for public clients, and client_secret_basic otherwise
+	TokenEndpointAuthMethod application.AuthMethod `json:"token_endpoint_auth_method,omitempty"`
+
+	// JWKS - The public keys of the application, passed by value
+	JWKS *key.JWKSet `json:"jwks,omitempty"`
+
+	// JWKSURI - Where the application serves its public keys. Cannot be used together with JWKS
+	JWKSURI string `json:"jwks_uri,omitempty"`
+
+	// RequestURIs - The URLs the application may pass in the request_uri parameter
+	RequestURIs []string `json:"request_uris,omitempty"`
+
+	// RequirePushedAuthorizationRequests - If true, the authorization endpoint only accepts pushed requests
+	RequirePushedAuthorizationRequests bool `json:"require_pushed_authorization_requests,omitempty"`
+
+	// TLSClientAuthSubjectDN - The subject DN the client certificate must have
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn,omitempty"`
+
+	// TLSClientAuthSANDNS - A DNS name the client certificate must have as a SAN
+	TLSClientAuthSANDNS string `json:"tls_client_auth_san_dns,omitempty"`
+
+	// TLSClientAuthSANURI - A URI the client certificate must have as a SAN
+	TLSClientAuthSANURI string `json:"tls_client_auth_san_uri,omitempty"`
+
+	// TLSClientAuthSANIP - An IP address the client certificate must have as a SAN
+	TLSClientAuthSANIP string `json:"tls_client_auth_san_ip,omitempty"`
+
+	// TLSClientAuthSANEmail - An email address the client certificate must have as a SAN
+	TLSClientAuthSANEmail string `json:"tls_client_auth_san_email,omitempty"`
+
+	// TLSClientCertificateBoundAccessTokens - If true, tokens issued to the application are bound to its client certificate
+	TLSClientCertificateBoundAccessTokens bool `json:"tls_client_certificate_bound_access_tokens,omitempty"`
+}
+
+/*
+registrationRequest - The body of a RFC 7591 registration request, or a RFC 7592 update request
+*/
+type registrationRequest struct {
+	ClientMetadata
+
+	// ClientID - Only sent with update requests, where it must match the application being updated
+	ClientID string `json:"client_id,omitempty"`
+
+	// ClientSecret - Optionally sent with update requests, where it must match the application being updated
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// SoftwareStatement - A signed JWT asserting client metadata, as described in RFC 7591 Section 2.3
+	SoftwareStatement string `json:"software_statement,omitempty"`
+}
+
+/*
+ClientInformation - A RFC 7591 Section 3.2.1 client information response. The registered metadata is
+returned along with the credentials of the application
+*/
+type ClientInformation struct {
+	ClientMetadata
+
+	// ClientID - The ClientID issued to the application
+	ClientID string `json:"client_id"`
+
+	// ClientSecret - The ClientSecret issued to the application. Only returned when a new secret is generated
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// ClientIDIssuedAt - When the ClientID was issued, in seconds since the epoch
+	ClientIDIssuedAt int64 `json:"client_id_issued_at"`
+
+	// ClientSecretExpiresAt - Always 0, as secrets issued through registration do not expire
+	ClientSecretExpiresAt int64 `json:"client_secret_expires_at"`
+
+	// RegistrationAccessToken - The token used to manage the registration. Only returned when the application is registered
+	RegistrationAccessToken string `json:"registration_access_token,omitempty"`
+
+	// RegistrationClientURI - The URL of the RFC 7592 client configuration endpoint for the application
+	RegistrationClientURI string `json:"registration_client_uri"`
+}
+
+/*
+newClientMetadata - Build the registrable client metadata of an application
+*/
+func newClientMetadata(app *application.Application) ClientMetadata {
+	return ClientMetadata{
+		ClientName:                            app.Name,
+		ClientType:                            app.Type,
+		RedirectURIs:                          app.RedirectURIs,
+		PostLogoutRedirectURIs:                app.PostLogoutRedirectURIs,
+		GrantTypes:                            app.GrantType,
+		TokenEndpointAuthMethod:               app.TokenEndpointAuthMethod,
+		JWKS:                                  app.JWKS,
+		JWKSURI:                               app.JWKSURI,
+		RequestURIs:                           app.RequestURIs,
+		RequirePushedAuthorizationRequests:    app.RequirePushedAuthorizationRequests,
+		TLSClientAuthSubjectDN:                app.TLSClientAuthSubjectDN,
+		TLSClientAuthSANDNS:                   app.TLSClientAuthSANDNS,
+		TLSClientAuthSANURI:                   app.TLSClientAuthSANURI,
+		TLSClientAuthSANIP:                    app.TLSClientAuthSANIP,
+		TLSClientAuthSANEmail:                 app.TLSClientAuthSANEmail,
+		TLSClientCertificateBoundAccessTokens: app.TLSClientCertificateBoundAccessTokens,
+	}
+}
+
+/*
+clientType - Returns the type of application being registered, inferring it from the grant types and
+auth method if it was not provided
+*/
+func (metadata *ClientMetadata) clientType() application.Type {
+	if metadata.ClientType != "" {
+		return metadata.ClientType
+	}
+
+	return application.InferType(metadata.GrantTypes, metadata.TokenEndpointAuthMethod)
+}
+
+/*
+apply - Overwrite the registrable fields of the application with the client metadata, filling in
+the defaults of the application type for anything that was omitted
+*/
+func (metadata *ClientMetadata) apply(app *application.Application) {
+	app.Name = metadata.ClientName
+	app.Type = metadata.clientType()
+	app.RedirectURIs = metadata.RedirectURIs
+	app.PostLogoutRedirectURIs = metadata.PostLogoutRedirectURIs
+	app.GrantType = metadata.GrantTypes
+	app.TokenEndpointAuthMethod = metadata.TokenEndpointAuthMethod
+	app.JWKS = metadata.JWKS
+	app.JWKSURI = metadata.JWKSURI
+	app.RequestURIs = metadata.RequestURIs
+	app.RequirePushedAuthorizationRequests = metadata.RequirePushedAuthorizationRequests
+	app.TLSClientAuthSubjectDN = metadata.TLSClientAuthSubjectDN
+	app.TLSClientAuthSANDNS = metadata.TLSClientAuthSANDNS
+	app.TLSClientAuthSANURI = metadata.TLSClientAuthSANURI
+	app.TLSClientAuthSANIP = metadata.TLSClientAuthSANIP
+	app.TLSClientAuthSANEmail = metadata.TLSClientAuthSANEmail
+	app.TLSClientCertificateBoundAccessTokens = metadata.TLSClientCertificateBoundAccessTokens
+
+	if len(app.GrantType) == 0 {
+		app.GrantType = app.Type.DefaultGrantTypes()
+	}
+
+	if app.TokenEndpointAuthMethod == "" {
+		app.TokenEndpointAuthMethod = app.Type.DefaultAuthMethod()
+	}
+}
+
+/*
+RegisterClient - A server.HandlerFunc for the RFC 7591 dynamic client registration endpoint. Should be
+registered under POST /oauth/register. Requests must either carry the initial access token of the
+Provider as a bearer token, or include a software statement signed by a trusted key. The response
+contains the only copy of the registration access token
+*/
+func (provider *Provider) RegisterClient(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		var request registrationRequest
+
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			abort(c, errInvalidClientMetadata("The request body must be a JSON object"))
+			return
+		}
+
+		authorized, authErr := provider.authorizeRegistration(c)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !authorized && request.SoftwareStatement == "" {
+			abort(c, errInvalidToken("An initial access token or software statement is required"))
+			return
+		}
+
+		metadata, authErr := provider.resolveClientMetadata(&request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		app, secret, err := application.New(metadata.ClientName, metadata.clientType(), metadata.GrantTypes, provider.hashingParameters())
+		if err != nil {
+			if errors.Is(err, application.ErrInvalidMetadata) {
+				abort(c, errInvalidClientMetadata(err.Error()))
+				return
+			}
+
+			slog.Error("Failed to build application", "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		metadata.apply(app)
+
+		authErr = validateClientMetadata(app)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !app.UsesClientSecret() {
+			app.ClientSecrets = nil
+			secret = ""
+		}
+
+		authErr = provider.sealClientSecret(app, secret)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		registrationToken, err := newHandle()
+		if err != nil {
+			slog.Error("Failed to generate registration access token", "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		app.RegistrationAccessTokenHash = hashHandle(registrationToken)
+
+		err = application.CreateApplication(service.Database(), app)
+		if err != nil {
+			slog.Error("Failed to create application", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		response := provider.clientInformation(app)
+		response.ClientSecret = secret
+		response.RegistrationAccessToken = registrationToken
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusCreated, response)
+	}
+}
+
+/*
+ReadRegistration - A server.HandlerFunc for reading the registration of an application through the
+RFC 7592 client configuration endpoint. Should be registered under GET /oauth/register/:client_id
+*/
+func (provider *Provider) ReadRegistration(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := authenticateRegistration(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, provider.clientInformation(app))
+	}
+}
+
+/*
+UpdateRegistration - A server.HandlerFunc for updating the registration of an application through the
+RFC 7592 client configuration endpoint. Should be registered under PUT /oauth/register/:client_id. The
+request replaces every registrable field, so omitted fields are reset to their defaults
+*/
+func (provider *Provider) UpdateRegistration(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := authenticateRegistration(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		var request registrationRequest
+
+		err := c.ShouldBindJSON(&request)
+		if err != nil {
+			abort(c, errInvalidClientMetadata("The request body must be a JSON object"))
+			return
+		}
+
+		if request.ClientID != app.ClientID {
+			abort(c, errInvalidRequest("The client_id does not match the registration being updated"))
+			return
+		}
+
+		if request.ClientSecret != "" && !app.ValidateClientSecret(request.ClientSecret) {
+			abort(c, errInvalidRequest("The client_secret does not match the registration being updated"))
+			return
+		}
+
+		metadata, authErr := provider.resolveClientMetadata(&request)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		metadata.apply(app)
+
+		authErr = validateClientMetadata(app)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		/*
+			Switching to an auth method that uses a secret issues a new one, as the
+			previous secret cannot be recovered from its hash. Switching to
+			client_secret_jwt also replaces secrets that were never sealed
+		*/
+		secret := ""
+		switch {
+		case !app.UsesClientSecret():
+			app.ClientSecrets = nil
+		case app.TokenEndpointAuthMethod == application.ClientSecretJWT && !hasSealedSecret(app):
+			app.ClientSecrets = nil
+			fallthrough
+		case len(app.ClientSecrets) == 0:
+			_, secret, err = app.AddClientSecret(provider.hashingParameters(), 0)
+			if err != nil {
+				slog.Error("Failed to generate client secret", "client_id", app.ClientID, "err", err)
+				abort(c, errServerError())
+				return
+			}
+		}
+
+		authErr = provider.sealClientSecret(app, secret)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		err = application.ReplaceApplication(service.Database(), app)
+		if err != nil {
+			slog.Error("Failed to replace application", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		response := provider.clientInformation(app)
+		response.ClientSecret = secret
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+/*
+DeleteRegistration - A server.HandlerFunc for deleting an application through the RFC 7592 client
+configuration endpoint. Should be registered under DELETE /oauth/register/:client_id
+*/
+func (provider *Provider) DeleteRegistration(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := authenticateRegistration(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		err := grant.DeleteApplication(service.Database(), app.ClientID)
+		if err != nil && !errors.Is(err, application.ErrApplicationDoesNotExist) {
+			slog.Error("Failed to delete application", "client_id", app.ClientID, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		c.Status(http.StatusNoContent)
+	}
+}
+
+/*
+hasSealedSecret - Returns true if one of the secrets of the application has been sealed for client_secret_jwt
+*/
+func hasSealedSecret(app *application.Application) bool {
+	return slices.ContainsFunc(app.ClientSecrets, func(secret *application.ClientSecret) bool {
+		return secret.HMACKey != ""
+	})
+}
+
+/*
+clientInformation - Build the client information response for an application. Client secrets and the
+registration access token are never included, as only their hashes are stored
+*/
+func (provider *Provider) clientInformation(app *application.Application) *ClientInformation {
+	response := &ClientInformation{
+		ClientMetadata:        newClientMetadata(app),
+		ClientID:              app.ClientID,
+		RegistrationClientURI: provider.endpoint("/oauth/register/" + app.ClientID),
+	}
+
+	if app.Metadata != nil {
+		response.ClientIDIssuedAt = app.Metadata.CreationDate / 1e9
+	}
+
+	return response
+}
+
+/*
+authorizeRegistration - Check the initial access token sent with a registration request. Returns false
+if no token was sent, in which case the request must be authorized by a software statement instead
+*/
+func (provider *Provider) authorizeRegistration(c *gin.Context) (bool, *Error) {
+	raw, ok := bearerCredential(c)
+	if !ok {
+		return false, nil
+	}
+
+	if provider.InitialAccessToken == "" || subtle.ConstantTimeCompare([]byte(raw), []byte(provider.InitialAccessToken)) != 1 {
+		return false, errInvalidToken("The initial access token is invalid")
+	}
+
+	return true, nil
+}
+
+/*
+authenticateRegistration - Resolve the application named in the client_id path parameter, and
+validate the registration access token sent with the request. As described in RFC 7592 Section 3,
+an application that does not exist is reported the same way as an invalid token
+*/
+func authenticateRegistration(c *gin.Context, service *server.Service) (*application.Application, *Error) {
+	raw, ok := bearerCredential(c)
+	if !ok {
+		return nil, errInvalidToken("A registration access token is required")
+	}
+
+	clientId := c.Param("client_id")
+
+	app, err := application.GetApplicationByClientID(service.Database(), clientId)
+	if err != nil {
+		if errors.Is(err, application.ErrApplicationDoesNotExist) {
+			return nil, errInvalidToken("The registration access token is invalid")
+		}
+
+		slog.Error("Failed to fetch application", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	expected := app.RegistrationAccessTokenHash
+	if expected == "" || subtle.ConstantTimeCompare([]byte(hashHandle(raw)), []byte(expected)) != 1 {
+		return nil, errInvalidToken("The registration access token is invalid")
+	}
+
+	return app, nil
+}
+
+/*
+bearerCredential - Returns the token sent in the Authorization header using the Bearer scheme
+*/
+func bearerCredential(c *gin.Context) (string, bool) {
+	scheme, raw, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	raw = strings.TrimSpace(raw)
+
+	if !ok || !strings.EqualFold(scheme, "Bearer") || raw == "" {
+		return "", false
+	}
+
+	return raw, true
+}
+
+/*
+resolveClientMetadata - Returns the client metadata of a registration request. If a software statement
+is included, its claims take precedence over the values sent in the request, as required by RFC 7591
+Section 3.1.1
+*/
+func (provider *Provider) resolveClientMetadata(request *registrationRequest) (*ClientMetadata, *Error) {
+	metadata := request.ClientMetadata
+
+	if request.SoftwareStatement == "" {
+		return &metadata, nil
+	}
+
+	if provider.SoftwareStatementJWKSURI == "" {
+		return nil, errUnapprovedSoftwareStatement("Software statements are not accepted")
+	}
+
+	claims := jwt.MapClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		request.SoftwareStatement,
+		claims,
+		provider.softwareStatementKeyfunc,
+		jwt.WithValidMethods(applicationAlgorithms),
+		jwt.WithLeeway(provider.Leeway),
+	)
+	if err != nil {
+		if errors.Is(err, ErrNoSoftwareStatementKey) {
+			return nil, errUnapprovedSoftwareStatement("The software statement was not signed by a trusted key")
+		}
+
+		return nil, errInvalidSoftwareStatement("The software statement could not be verified")
+	}
+
+	issuer, _ := claims.GetIssuer()
+	if issuer == "" {
+		return nil, errInvalidSoftwareStatement("The software statement must contain an iss claim")
+	}
+
+	/*
+		Decoding the claims over the request metadata only replaces the fields
+		that the software statement asserts
+	*/
+	encoded, err := json.Marshal(claims)
+	if err == nil {
+		err = json.Unmarshal(encoded, &metadata)
+	}
+	if err != nil {
+		return nil, errInvalidSoftwareStatement("The software statement contains invalid client metadata")
+	}
+
+	return &metadata, nil
+}
+
+/*
+softwareStatementKeyfunc - A jwt.Keyfunc that resolves the key a software statement was signed with
+from the JWK Set served at SoftwareStatementJWKSURI
+*/
+func (provider *Provider) softwareStatementKeyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	set, err := key.FetchJWKSet(provider.SoftwareStatementJWKSURI, false)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk := set.Find(kid)
+	if jwk == nil {
+		set, err = key.FetchJWKSet(provider.SoftwareStatementJWKSURI, true)
+		if err != nil {
+			return nil, err
+		}
+
+		jwk = set.Find(kid)
+	}
+
+	if jwk == nil || (jwk.Algorithm != "" && jwk.Algorithm != token.Method.Alg()) || (jwk.Use != "" && jwk.Use != "sig") {
+		return nil, ErrNoSoftwareStatementKey
+	}
+
+	return jwk.PublicKey()
+}
+
+/*
+validateClientMetadata - Validate the metadata of an application that is being registered, and convert
+any errors into RFC 7591 Section 3.2.2 error responses
+*/
+func validateClientMetadata(app *application.Application) *Error {
+	err := app.Validate()
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, application.ErrInvalidRedirectURI) {
+		return errInvalidRedirectURI(err.Error())
+	}
+
+	return errInvalidClientMetadata(err.Error())
+}
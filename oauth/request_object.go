@@ -0,0 +1,272 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNoApplicationKey - Gets returned when a JWT sent by an application is signed with a key it has not registered
+var ErrNoApplicationKey = errors.New("oauth: Signing key has not been registered with the application")
+
+// requestObjectMaxSize - The largest request object, in bytes, that will be fetched from a request_uri
+const requestObjectMaxSize = 64 << 10
+
+// requestObjectClient - The HTTP client used to fetch request objects from a request_uri
+var requestObjectClient = &http.Client{Timeout: 5 * time.Second}
+
+// applicationAlgorithms - The algorithms applications may sign request objects with. Only asymmetric algorithms are accepted
+var applicationAlgorithms = []string{string(api.RS256), string(api.ES256), string(api.EdDSA)}
+
+/*
+replayStore - Where single use JWTs are recorded. Inserting a JWT that has already been recorded
+must fail with a duplicate key error. Satisfied by server.Database
+*/
+type replayStore interface {
+	Insert(collection string, model interface{}) error
+}
+
+/*
+usedRequestObject - An entry in the request object replay cache. The ID is derived from the
+ClientID and the jti of the request object, so two applications can never collide
+*/
+type usedRequestObject struct {
+	// ID - The hex encoded SHA-256 hash of the ClientID and jti of the request object
+	ID string `bson:"_id"`
+
+	// ExpiresAt - The expiration of the request object. MongoDB removes the entry after this
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// requestObjectClaims - Registered claims of a request object that are not authorization request parameters
+var requestObjectClaims = []string{"iss", "aud", "exp", "iat", "nbf", "jti", "request", "request_uri"}
+
+/*
+applicationKeyfunc - Returns a jwt.Keyfunc that resolves the public key a JWT was signed with from
+the keys registered with the application. If the kid is not found in a remote JWK Set, the set is
+downloaded again in case the application has rotated its keys
+*/
+func applicationKeyfunc(app *application.Application) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+
+		set, err := app.PublicKeys(false)
+		if err != nil {
+			return nil, err
+		}
+
+		jwk := set.Find(kid)
+		if jwk == nil && app.JWKSURI != "" {
+			set, err = app.PublicKeys(true)
+			if err != nil {
+				return nil, err
+			}
+
+			jwk = set.Find(kid)
+		}
+
+		if jwk == nil {
+			return nil, ErrNoApplicationKey
+		}
+
+		if (jwk.Algorithm != "" && jwk.Algorithm != token.Method.Alg()) || (jwk.Use != "" && jwk.Use != "sig") {
+			return nil, ErrNoApplicationKey
+		}
+
+		return jwk.PublicKey()
+	}
+}
+
+/*
+expandRequestObject - Resolve the request object of a RFC 9101 authorization request, passed either
+by value in the request parameter, or by reference in the request_uri parameter. The request object
+must be signed by the application, and only its parameters are used. Parameters that are also sent
+outside of the request object must match. If neither parameter is present, the values are returned
+unchanged
+*/
+func (provider *Provider) expandRequestObject(database *server.Database, values url.Values) (url.Values, *Error) {
+	raw := values.Get("request")
+	requestUri := values.Get("request_uri")
+
+	if raw == "" && requestUri == "" {
+		return values, nil
+	}
+
+	if raw != "" && requestUri != "" {
+		return nil, errInvalidRequest("The request and request_uri parameters cannot be used together")
+	}
+
+	clientId := values.Get("client_id")
+	if clientId == "" {
+		return nil, errInvalidRequest("The client_id parameter is required")
+	}
+
+	app, err := application.GetApplicationByClientID(database, clientId)
+	if err != nil {
+		if errors.Is(err, application.ErrApplicationDoesNotExist) {
+			return nil, errInvalidRequest("The client_id parameter is invalid")
+		}
+
+		slog.Error("Failed to fetch application", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	return provider.decodeRequestObject(database, app, values)
+}
+
+/*
+decodeRequestObject - Verify the request object passed in the request or request_uri parameter
+against the keys of the application, and return its parameters. Each request object must have a
+jti, which is recorded in the replayStore passed in the used parameter so that a captured request
+object cannot be used again before it expires
+*/
+func (provider *Provider) decodeRequestObject(used replayStore, app *application.Application, values url.Values) (url.Values, *Error) {
+	clientId := app.ClientID
+	raw := values.Get("request")
+	requestUri := values.Get("request_uri")
+
+	var err error
+
+	/*
+		Only registered request_uri values are fetched, otherwise the authorization
+		endpoint could be used to make requests to arbitrary hosts
+	*/
+	if requestUri != "" {
+		if !app.HasRequestURI(requestUri) {
+			return nil, errInvalidRequestURI("The request_uri has not been registered with the application")
+		}
+
+		raw, err = fetchRequestObject(requestUri)
+		if err != nil {
+			slog.Warn("Failed to fetch request object", "client_id", clientId, "err", err)
+			return nil, errInvalidRequestURI("The request object could not be fetched")
+		}
+	}
+
+	claims := jwt.MapClaims{}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(applicationAlgorithms),
+		jwt.WithIssuer(clientId),
+		jwt.WithAudience(provider.Issuer),
+		jwt.WithLeeway(provider.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+
+	_, err = parser.ParseWithClaims(raw, claims, applicationKeyfunc(app))
+	if err != nil {
+		slog.Warn("Rejected request object", "client_id", clientId, "err", err)
+		return nil, errInvalidRequestObject("The request object could not be validated")
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return nil, errInvalidRequestObject("The request object must contain a jti")
+	}
+
+	expiresAt, _ := claims.GetExpirationTime()
+	digest := sha256.Sum256([]byte(clientId + ":" + jti))
+
+	err = used.Insert("request_object", &usedRequestObject{
+		ID:        hex.EncodeToString(digest[:]),
+		ExpiresAt: expiresAt.Time.Add(provider.Leeway),
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errInvalidRequestObject("The request object has already been used")
+		}
+
+		slog.Error("Failed to record request object", "client_id", clientId, "err", err)
+		return nil, errServerError()
+	}
+
+	ret := url.Values{}
+	for name, value := range claims {
+		if slices.Contains(requestObjectClaims, name) {
+			continue
+		}
+
+		ret.Set(name, requestObjectValue(value))
+	}
+
+	if ret.Get("client_id") != clientId {
+		return nil, errInvalidRequestObject("The client_id of the request object does not match the client_id parameter")
+	}
+
+	for name, outer := range values {
+		if name == "request" || name == "request_uri" {
+			continue
+		}
+
+		inner, ok := ret[name]
+		if ok && (len(outer) != 1 || outer[0] != inner[0]) {
+			return nil, errInvalidRequest(fmt.Sprintf("The %s parameter does not match the request object", name))
+		}
+	}
+
+	return ret, nil
+}
+
+/*
+requestObjectValue - Convert a claim of a request object into the form it would have as a query
+parameter. Strings are used as is, and anything else is encoded as JSON
+*/
+func requestObjectValue(value interface{}) string {
+	switch value := value.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+
+	return string(encoded)
+}
+
+/*
+fetchRequestObject - Download the request object served at the URI passed in the requestUri parameter
+*/
+func fetchRequestObject(requestUri string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, requestUri, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/oauth-authz-req+jwt")
+
+	resp, err := requestObjectClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, requestObjectMaxSize))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(body)), nil
+}
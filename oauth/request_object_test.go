@@ -0,0 +1,338 @@
+package oauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testIssuer - The issuer of the Provider used in tests
+const testIssuer = "https://idp.example.com"
+
+/*
+newSigningApplication - Build an application with a single inline P-256 key, and return the private
+key so that tests can sign JWTs as the application
+*/
+func newSigningApplication(t *testing.T) (*application.Application, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := key.NewJWK(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk.KeyID = "app-key"
+
+	app := &application.Application{
+		ClientID: "client-1",
+		JWKS:     &key.JWKSet{Keys: []*key.JWK{jwk}},
+	}
+
+	return app, private
+}
+
+/*
+signRequestObject - Sign the claims passed in the claims parameter as an ES256 request object
+*/
+func signRequestObject(t *testing.T, private *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	unsigned.Header["kid"] = "app-key"
+
+	signed, err := unsigned.SignedString(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+/*
+memoryReplayStore - A replayStore that keeps used JWTs in memory, and fails with a duplicate key
+error when the same ID is inserted twice
+*/
+type memoryReplayStore struct {
+	used map[string]bool
+}
+
+func newMemoryReplayStore() *memoryReplayStore {
+	return &memoryReplayStore{used: map[string]bool{}}
+}
+
+func (store *memoryReplayStore) Insert(collection string, model interface{}) error {
+	id := model.(*usedRequestObject).ID
+	if store.used[id] {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000}}}
+	}
+
+	store.used[id] = true
+
+	return nil
+}
+
+/*
+requestObjectClaimsFor - The claims of a valid request object for the application passed in the app parameter
+*/
+func requestObjectClaimsFor(app *application.Application) jwt.MapClaims {
+	now := time.Now()
+
+	return jwt.MapClaims{
+		"jti":           uuid.NewString(),
+		"iss":           app.ClientID,
+		"aud":           testIssuer,
+		"iat":           now.Unix(),
+		"exp":           now.Add(time.Minute).Unix(),
+		"client_id":     app.ClientID,
+		"response_type": "code",
+		"scope":         "openid",
+		"max_age":       300,
+	}
+}
+
+func TestExpandRequestObjectWithoutRequest(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer}
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		wantCode string
+	}{
+		{name: "plain request", values: url.Values{"client_id": {"client-1"}}},
+		{name: "request and request_uri", values: url.Values{"client_id": {"client-1"}, "request": {"a"}, "request_uri": {"b"}}, wantCode: "invalid_request"},
+		{name: "missing client_id", values: url.Values{"request": {"a"}}, wantCode: "invalid_request"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, authErr := provider.expandRequestObject(nil, test.values)
+			if test.wantCode != "" {
+				if authErr == nil || authErr.Code != test.wantCode {
+					t.Fatalf("expected %s, got %v", test.wantCode, authErr)
+				}
+				return
+			}
+
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+
+			if values.Get("client_id") != "client-1" {
+				t.Fatal("expected the values to be returned unchanged")
+			}
+		})
+	}
+}
+
+func TestDecodeRequestObject(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer}
+	app, private := newSigningApplication(t)
+	_, otherPrivate := newSigningApplication(t)
+
+	valid := requestObjectClaimsFor(app)
+
+	expired := requestObjectClaimsFor(app)
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	wrongAudience := requestObjectClaimsFor(app)
+	wrongAudience["aud"] = "https://other.example.com"
+
+	wrongClient := requestObjectClaimsFor(app)
+	wrongClient["client_id"] = "client-2"
+
+	withoutJti := requestObjectClaimsFor(app)
+	delete(withoutJti, "jti")
+
+	tests := []struct {
+		name     string
+		values   url.Values
+		wantCode string
+	}{
+		{
+			name:   "by value",
+			values: url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, valid)}},
+		},
+		{
+			name:   "matching outer parameter",
+			values: url.Values{"client_id": {app.ClientID}, "response_type": {"code"}, "request": {signRequestObject(t, private, valid)}},
+		},
+		{
+			name:     "conflicting outer parameter",
+			values:   url.Values{"client_id": {app.ClientID}, "scope": {"profile"}, "request": {signRequestObject(t, private, valid)}},
+			wantCode: "invalid_request",
+		},
+		{
+			name:     "unregistered key",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, otherPrivate, valid)}},
+			wantCode: "invalid_request_object",
+		},
+		{
+			name:     "expired",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, expired)}},
+			wantCode: "invalid_request_object",
+		},
+		{
+			name:     "wrong audience",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, wrongAudience)}},
+			wantCode: "invalid_request_object",
+		},
+		{
+			name:     "mismatched client_id",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, wrongClient)}},
+			wantCode: "invalid_request_object",
+		},
+		{
+			name:     "missing jti",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, withoutJti)}},
+			wantCode: "invalid_request_object",
+		},
+		{
+			name:     "unsigned",
+			values:   url.Values{"client_id": {app.ClientID}, "request": {"eyJhbGciOiJub25lIn0.e30."}},
+			wantCode: "invalid_request_object",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, authErr := provider.decodeRequestObject(newMemoryReplayStore(), app, test.values)
+			if test.wantCode != "" {
+				if authErr == nil || authErr.Code != test.wantCode {
+					t.Fatalf("expected %s, got %v", test.wantCode, authErr)
+				}
+				return
+			}
+
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+
+			if values.Get("scope") != "openid" || values.Get("max_age") != "300" {
+				t.Fatalf("unexpected parameters: %v", values)
+			}
+
+			if values.Has("iss") || values.Has("request") {
+				t.Fatalf("registered claims should not be returned as parameters: %v", values)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestObjectByReference(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer}
+	app, private := newSigningApplication(t)
+
+	signed := signRequestObject(t, private, requestObjectClaimsFor(app))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/request", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/oauth-authz-req+jwt")
+		_, _ = w.Write([]byte(signed))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	client := requestObjectClient
+	requestObjectClient = server.Client()
+	defer func() { requestObjectClient = client }()
+
+	app.RequestURIs = []string{server.URL + "/request", server.URL + "/missing"}
+
+	tests := []struct {
+		name       string
+		requestUri string
+		wantCode   string
+	}{
+		{name: "registered", requestUri: server.URL + "/request"},
+		{name: "registered with fragment", requestUri: server.URL + "/request#v2"},
+		{name: "unregistered", requestUri: server.URL + "/other", wantCode: "invalid_request_uri"},
+		{name: "not served", requestUri: server.URL + "/missing", wantCode: "invalid_request_uri"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			values, authErr := provider.decodeRequestObject(newMemoryReplayStore(), app, url.Values{
+				"client_id":   {app.ClientID},
+				"request_uri": {test.requestUri},
+			})
+			if test.wantCode != "" {
+				if authErr == nil || authErr.Code != test.wantCode {
+					t.Fatalf("expected %s, got %v", test.wantCode, authErr)
+				}
+				return
+			}
+
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+
+			if values.Get("response_type") != "code" {
+				t.Fatalf("unexpected parameters: %v", values)
+			}
+		})
+	}
+}
+
+func TestDecodeRequestObjectReplay(t *testing.T) {
+	provider := &Provider{Issuer: testIssuer}
+	store := newMemoryReplayStore()
+
+	app, private := newSigningApplication(t)
+	other, otherPrivate := newSigningApplication(t)
+	other.ClientID = "client-2"
+
+	claims := requestObjectClaimsFor(app)
+	otherClaims := requestObjectClaimsFor(other)
+	otherClaims["jti"] = claims["jti"]
+
+	first := url.Values{"client_id": {app.ClientID}, "request": {signRequestObject(t, private, claims)}}
+
+	tests := []struct {
+		name     string
+		app      *application.Application
+		values   url.Values
+		wantCode string
+	}{
+		{name: "first use", app: app, values: first},
+		{name: "replayed", app: app, values: first, wantCode: "invalid_request_object"},
+		{
+			name:   "same jti from another application",
+			app:    other,
+			values: url.Values{"client_id": {other.ClientID}, "request": {signRequestObject(t, otherPrivate, otherClaims)}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, authErr := provider.decodeRequestObject(store, test.app, test.values)
+			if test.wantCode != "" {
+				if authErr == nil || authErr.Code != test.wantCode {
+					t.Fatalf("expected %s, got %v", test.wantCode, authErr)
+				}
+				return
+			}
+
+			if authErr != nil {
+				t.Fatalf("unexpected error: %v", authErr)
+			}
+		})
+	}
+}
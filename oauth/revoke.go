@@ -0,0 +1,120 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"net/http"
+)
+
+/*
+Revoke - A server.HandlerFunc for the RFC 7009 revocation endpoint. Should be registered under
+POST /oauth/revoke. Access tokens are added to the deny list until they expire, and revoking a
+refresh token revokes every refresh token in its family. As required by RFC 7009, invalid or
+unknown tokens do not result in an error
+*/
+func (provider *Provider) Revoke(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		app, authErr := provider.authenticateClient(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		raw := c.PostForm("token")
+		if raw == "" {
+			abort(c, errInvalidRequest("The token parameter is required"))
+			return
+		}
+
+		var found bool
+		var revokeErr *Error
+
+		/*
+			Like introspection, the token_type_hint only decides which lookup is
+			attempted first
+		*/
+		if c.PostForm("token_type_hint") == "refresh_token" {
+			found, revokeErr = provider.revokeRefreshToken(service, app, raw)
+			if revokeErr == nil && !found {
+				_, revokeErr = provider.revokeAccessToken(service, app, raw)
+			}
+		} else {
+			found, revokeErr = provider.revokeAccessToken(service, app, raw)
+			if revokeErr == nil && !found {
+				_, revokeErr = provider.revokeRefreshToken(service, app, raw)
+			}
+		}
+
+		if revokeErr != nil {
+			abort(c, revokeErr)
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Status(http.StatusOK)
+	}
+}
+
+/*
+revokeAccessToken - Add the jti of a JWT access token to the deny list. Returns false if the
+value passed in the raw parameter is not a valid access token
+*/
+func (provider *Provider) revokeAccessToken(service *server.Service, app *application.Application, raw string) (bool, *Error) {
+	claims, err := provider.verifyAccessToken(service, raw)
+	if err != nil {
+		slog.Error("Failed to verify access token for revocation", "client_id", app.ClientID, "err", err)
+		return false, errServerError()
+	}
+
+	if claims == nil {
+		return false, nil
+	}
+
+	if claims.ClientID != app.ClientID {
+		return true, errUnauthorizedClient("The token was not issued to this application")
+	}
+
+	err = token.Revoke(service.Database(), claims.ID, claims.ExpiresAt.Time)
+	if err != nil {
+		slog.Error("Failed to revoke access token", "client_id", app.ClientID, "jti", claims.ID, "err", err)
+		return true, errServerError()
+	}
+
+	slog.Info("Access token was revoked", "client_id", app.ClientID, "jti", claims.ID)
+
+	return true, nil
+}
+
+/*
+revokeRefreshToken - Revoke the family of an opaque refresh token. Returns false if the value
+passed in the raw parameter is not a known refresh token
+*/
+func (provider *Provider) revokeRefreshToken(service *server.Service, app *application.Application, raw string) (bool, *Error) {
+	refresh, err := token.GetRefreshToken(service.Database(), raw)
+	if err != nil {
+		if errors.Is(err, token.ErrRefreshTokenDoesNotExist) {
+			return false, nil
+		}
+
+		slog.Error("Failed to fetch refresh token for revocation", "client_id", app.ClientID, "err", err)
+		return false, errServerError()
+	}
+
+	if refresh.ClientID != app.ClientID {
+		return true, errUnauthorizedClient("The token was not issued to this application")
+	}
+
+	err = token.RevokeRefreshTokenFamily(service.Database(), refresh.FamilyID)
+	if err != nil {
+		slog.Error("Failed to revoke refresh token", "client_id", app.ClientID, "family_id", refresh.FamilyID, "err", err)
+		return true, errServerError()
+	}
+
+	slog.Info("Refresh token family was revoked", "client_id", app.ClientID, "family_id", refresh.FamilyID)
+
+	return true, nil
+}
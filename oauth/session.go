@@ -0,0 +1,27 @@
+package oauth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"time"
+)
+
+/*
+Session - A user that has signed in to simple-idp. Sessions are owned by the login UI
+of the caller, so the Provider only ever consumes them through an Authenticator
+*/
+type Session struct {
+	// User - The user that is signed in
+	User *user.User
+
+	// AuthTime - The time that the user last actively authenticated
+	AuthTime time.Time
+}
+
+/*
+Authenticator - Resolves the user that is signed in for the request passed in the c parameter. If
+no user is signed in, a nil Session should be returned without an error. The Provider then sends
+the user to Provider.LoginURL
+*/
+type Authenticator func(service *server.Service, c *gin.Context) (*Session, error)
@@ -0,0 +1,183 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"net/http"
+	"slices"
+)
+
+/*
+TokenResponse - A successful RFC 6749 Section 5.1 token response
+*/
+type TokenResponse struct {
+	// AccessToken - The access token issued by simple-idp
+	AccessToken string `json:"access_token"`
+
+	// TokenType - The type of the access token. Either Bearer or DPoP
+	TokenType string `json:"token_type"`
+
+	// ExpiresIn - The number of seconds until the access token expires
+	ExpiresIn int `json:"expires_in"`
+
+	// RefreshToken - An opaque refresh token. Only issued to applications allowed to use the refresh_token grant
+	RefreshToken string `json:"refresh_token,omitempty"`
+
+	// Scope - A space delimited list of the scopes that were granted
+	Scope string `json:"scope,omitempty"`
+
+	// IDToken - An OpenID Connect ID token. Only issued if the openid scope was granted
+	IDToken string `json:"id_token,omitempty"`
+
+	// IssuedTokenType - The type of the token that was issued. Only included in token exchange responses
+	IssuedTokenType string `json:"issued_token_type,omitempty"`
+}
+
+/*
+Token - A server.HandlerFunc for the token endpoint. Should be registered under POST /oauth/token
+*/
+func (provider *Provider) Token(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		grantType := application.GrantType(c.PostForm("grant_type"))
+		if grantType == "" {
+			abort(c, errInvalidRequest("The grant_type parameter is required"))
+			return
+		}
+
+		app, authErr := provider.authenticateClient(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		if !app.HasGrantType(grantType) {
+			abort(c, errUnauthorizedClient("The application is not allowed to use this grant type"))
+			return
+		}
+
+		authErr = provider.verifyTokenDPoP(c, service)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		authErr = bindCertificate(c, app)
+		if authErr != nil {
+			abort(c, authErr)
+			return
+		}
+
+		var response *TokenResponse
+		var grantErr *Error
+
+		switch grantType {
+		case application.ClientCredentials:
+			response, grantErr = provider.clientCredentials(c, service, app)
+		case application.AuthorizationCodePKCE:
+			response, grantErr = provider.authorizationCode(c, service, app)
+		case application.RefreshToken:
+			response, grantErr = provider.refreshToken(c, service, app)
+		case application.DeviceCode:
+			response, grantErr = provider.deviceCode(c, service, app)
+		case application.TokenExchange:
+			response, grantErr = provider.tokenExchange(c, service, app)
+		default:
+			grantErr = errUnsupportedGrantType("The grant type is not supported")
+		}
+
+		if grantErr != nil {
+			abort(c, grantErr)
+			return
+		}
+
+		if c.GetString(dpopThumbprintKey) != "" {
+			response.TokenType = "DPoP"
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.Header("Pragma", "no-cache")
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+/*
+issueAccessToken - Build and sign an access token for the API passed in the target parameter. The
+scopes passed in the scopes parameter should already be filtered with grantScopes. If the openid
+scope was granted, tokens signed with one of userinfoAlgorithms can also be used at the userinfo endpoint. If the API has AddPermissions
+set, the permissions of the subject are resolved from their roles and direct assignments, and limited to
+the granted scopes. The client parameter should be true if the application is authenticating as itself
+rather than on behalf of a user. The actor parameter should be nil unless the token is issued through
+token exchange. If the request was made with a DPoP proof or a bound client certificate, the token is
+bound to the key
+*/
+func (provider *Provider) issueAccessToken(c *gin.Context, service *server.Service, target *api.API, subject string, client bool, clientId string, scopes []string, actor *token.Actor) (string, *token.Claims, error) {
+	claims, err := token.NewClaims(provider.Issuer, subject, target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	claims.ClientID = clientId
+	claims.Scope = scope.Format(scopes)
+	claims.Actor = actor
+	claims.Confirmation = confirmation(c)
+
+	if target.AddPermissions {
+		claims.Permissions, err = permissions(c, service, target, subject, client, scopes)
+		if err != nil {
+			return "", nil, err
+		}
+	}
+
+	userinfo := provider.userinfoAudience()
+	if slices.Contains(scopes, "openid") && slices.Contains(userinfoAlgorithms, target.TokenType) && target.Audience != userinfo {
+		claims.Audience = append(claims.Audience, userinfo)
+	}
+
+	signed, err := token.SignForAPI(service.Database(), claims, target)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return signed, claims, nil
+}
+
+/*
+verifyAccessToken - Verify an access token issued by the Provider against the API it was issued
+for. Access tokens that can be used at the userinfo endpoint carry a second audience, so the
+first audience that resolves to an API is used. If the token is invalid or has been revoked,
+nil is returned without an error
+*/
+func (provider *Provider) verifyAccessToken(service *server.Service, raw string) (*token.Claims, error) {
+	unverified, err := token.ParseUnverified(raw)
+	if err != nil {
+		return nil, nil
+	}
+
+	var target *api.API
+	for _, audience := range unverified.Audience {
+		target, err = provider.resolveAPI(service.Database(), audience)
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, err
+		}
+	}
+
+	if target == nil {
+		return nil, nil
+	}
+
+	claims, err := provider.verifier(service).Verify(raw, target)
+	if err != nil {
+		return nil, nil
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,236 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/grant"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"log/slog"
+	"slices"
+)
+
+// accessTokenType - The RFC 8693 token type identifier of access tokens issued by simple-idp
+const accessTokenType = "urn:ietf:params:oauth:token-type:access_token"
+
+/*
+tokenExchange - Handles the token exchange grant described in RFC 8693. A subject token is exchanged
+for an access token to another API, limited to the scopes of the subject token. If an actor token is
+provided, the issued token records the actor in the act claim (delegation). Otherwise the application
+impersonates the subject, which must be allowed by its TokenExchangePolicy
+*/
+func (provider *Provider) tokenExchange(c *gin.Context, service *server.Service, app *application.Application) (*TokenResponse, *Error) {
+	if c.PostForm("subject_token") == "" {
+		return nil, errInvalidRequest("The subject_token parameter is required")
+	}
+
+	if c.PostForm("subject_token_type") != accessTokenType {
+		return nil, errInvalidRequest("The subject_token_type must be " + accessTokenType)
+	}
+
+	requestedType := c.PostForm("requested_token_type")
+	if requestedType != "" && requestedType != accessTokenType {
+		return nil, errInvalidRequest("Only access tokens can be requested")
+	}
+
+	audience := c.PostForm("audience")
+	if audience == "" {
+		return nil, errInvalidRequest("The audience parameter is required")
+	}
+
+	if !app.CanExchangeTo(audience) {
+		return nil, errInvalidTarget("The application is not allowed to exchange tokens for this audience")
+	}
+
+	subject, exchangeErr := provider.exchangedToken(c, service, c.PostForm("subject_token"))
+	if exchangeErr != nil {
+		return nil, exchangeErr
+	}
+
+	/*
+		An application can only exchange tokens that were issued to it, or that were issued
+		for an API it serves. Otherwise any leaked token could be exchanged by any
+		application with a TokenExchangePolicy
+	*/
+	var apis []*api.API
+	var grants []*grant.Grant
+	var err error
+
+	if subject.ClientID != app.ClientID {
+		apis, err = provider.subjectAPIs(service.Database(), subject)
+		if err != nil {
+			slog.Error("Failed to fetch subject token API", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+
+		grants, err = grant.ListGrants(service.Database(), app.Metadata.Id)
+		if err != nil {
+			slog.Error("Failed to fetch client grants", "client_id", app.ClientID, "err", err)
+			return nil, errServerError()
+		}
+	}
+
+	if !canExchangeSubject(app, subject, apis, grants) {
+		return nil, errInvalidRequest("The subject_token was not issued to this application or for an API it serves")
+	}
+
+	/*
+		The chain of previous actors recorded in the subject token is always kept,
+		so the issued token never hides who has acted on behalf of the subject
+	*/
+	actor := subject.Actor
+
+	if c.PostForm("actor_token") != "" {
+		if c.PostForm("actor_token_type") != accessTokenType {
+			return nil, errInvalidRequest("The actor_token_type must be " + accessTokenType)
+		}
+
+		acting, exchangeErr := provider.exchangedToken(c, service, c.PostForm("actor_token"))
+		if exchangeErr != nil {
+			return nil, exchangeErr
+		}
+
+		if acting.ClientID != app.ClientID {
+			return nil, errInvalidRequest("The actor_token was not issued to this application")
+		}
+
+		actor = &token.Actor{
+			Subject:  acting.Subject,
+			ClientID: acting.ClientID,
+			Actor:    subject.Actor,
+		}
+	} else if !app.TokenExchange.AllowImpersonation {
+		return nil, errInvalidRequest("The actor_token parameter is required")
+	}
+
+	target, err := provider.resolveAPI(service.Database(), audience)
+	if err != nil {
+		if errors.Is(err, api.ErrAPIDoesNotExist) {
+			return nil, errInvalidTarget("The requested audience does not exist")
+		}
+
+		slog.Error("Failed to fetch API", "audience", audience, "err", err)
+		return nil, errServerError()
+	}
+
+	/*
+		Scopes can only be narrowed. Anything requested must have been granted to the
+		subject token, and must also be understood by the API being exchanged into
+	*/
+	granted := scope.Parse(subject.Scope)
+	requested := granted
+
+	if c.PostForm("scope") != "" {
+		requested = scope.Parse(c.PostForm("scope"))
+		for _, name := range requested {
+			if !slices.Contains(granted, name) {
+				return nil, errInvalidScope("The requested scope exceeds the scope of the subject token")
+			}
+		}
+	}
+
+	scopes := grantScopes(target, requested)
+	if c.PostForm("scope") != "" && len(scopes) == 0 {
+		return nil, errInvalidScope("None of the requested scopes are defined by the API")
+	}
+
+	/*
+		A subject token the provider issued to an application for itself keeps being
+		treated as one, so it is not looked up as a user
+	*/
+	client := subject.Subject == subject.ClientID+clientSubjectSuffix
+
+	accessToken, _, err := provider.issueAccessToken(c, service, target, subject.Subject, client, app.ClientID, scopes, actor)
+	if err != nil {
+		slog.Error("Failed to issue access token", "client_id", app.ClientID, "err", err)
+		return nil, errServerError()
+	}
+
+	return &TokenResponse{
+		AccessToken:     accessToken,
+		TokenType:       "Bearer",
+		ExpiresIn:       target.TokenLifetime,
+		Scope:           scope.Format(scopes),
+		IssuedTokenType: accessTokenType,
+	}, nil
+}
+
+/*
+subjectAPIs - Resolve the audiences of a subject token to the API's they identify. The userinfo
+audience, and audiences that no longer belong to an API, are skipped
+*/
+func (provider *Provider) subjectAPIs(database *server.Database, subject *token.Claims) ([]*api.API, error) {
+	var ret []*api.API
+
+	for _, audience := range subject.Audience {
+		if audience == provider.userinfoAudience() {
+			continue
+		}
+
+		target, err := api.GetAPIByAudience(database, audience)
+		if err != nil {
+			if errors.Is(err, api.ErrAPIDoesNotExist) {
+				continue
+			}
+			return nil, err
+		}
+
+		ret = append(ret, target)
+	}
+
+	return ret, nil
+}
+
+/*
+canExchangeSubject - Returns true if the application may exchange the subject token. Tokens issued to
+the application can always be exchanged. Tokens issued to another application can only be exchanged if
+the application serves one of the API's passed in the apis parameter, which should be the audiences of
+the subject token. An application serves an API if one of the grants passed in the grants parameter is
+for it, or its TokenExchangePolicy lists the API's audience
+*/
+func canExchangeSubject(app *application.Application, subject *token.Claims, apis []*api.API, grants []*grant.Grant) bool {
+	if subject.ClientID == app.ClientID {
+		return true
+	}
+
+	for _, target := range apis {
+		if app.CanExchangeTo(target.Audience) {
+			return true
+		}
+
+		for _, clientGrant := range grants {
+			if clientGrant.APIID == target.Metadata.Id {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+exchangedToken - Verify a subject or actor token passed to the token exchange grant. Only
+access tokens issued by this Provider, that have not expired or been revoked, are accepted.
+Sender-constrained tokens are only accepted if the request proves possession of the key they
+are bound to, so that exchanging a token cannot be used to move it onto another key
+*/
+func (provider *Provider) exchangedToken(c *gin.Context, service *server.Service, raw string) (*token.Claims, *Error) {
+	claims, err := provider.verifyAccessToken(service, raw)
+	if err != nil {
+		slog.Error("Failed to verify exchanged token", "err", err)
+		return nil, errServerError()
+	}
+
+	if claims == nil {
+		return nil, errInvalidRequest("The token is invalid, expired or has been revoked")
+	}
+
+	if claims.Confirmation != nil && !claims.Confirmation.Matches(confirmation(c)) {
+		return nil, errInvalidRequest("The token is bound to a key that was not presented with the request")
+	}
+
+	return claims, nil
+}
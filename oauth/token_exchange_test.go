@@ -0,0 +1,82 @@
+package oauth
+
+import (
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/application"
+	"github.com/stevezaluk/simple-idp-lib/grant"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"testing"
+)
+
+/*
+newExchangeAPI - Build an API with the audience passed in the audience parameter
+*/
+func newExchangeAPI(t *testing.T, audience string) *api.API {
+	t.Helper()
+
+	target, err := api.New(audience, audience, api.RS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return target
+}
+
+func TestCanExchangeSubject(t *testing.T) {
+	orders := newExchangeAPI(t, "https://orders.example.com")
+	billing := newExchangeAPI(t, "https://billing.example.com")
+
+	meta, err := metadata.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/*
+		The orders service receives user tokens issued to the SPA for its own API, and
+		exchanges them for tokens to the billing API
+	*/
+	service := &application.Application{
+		Metadata:      meta,
+		ClientID:      "orders-service",
+		TokenExchange: &application.TokenExchangePolicy{Audiences: []string{billing.Audience}},
+	}
+
+	userToken := &token.Claims{ClientID: "spa"}
+	userToken.Audience = []string{orders.Audience}
+
+	ownToken := &token.Claims{ClientID: service.ClientID}
+	ownToken.Audience = []string{billing.Audience}
+
+	ordersGrant := &grant.Grant{ApplicationID: meta.Id, APIID: orders.Metadata.Id}
+	billingGrant := &grant.Grant{ApplicationID: meta.Id, APIID: billing.Metadata.Id}
+
+	servingPolicy := &application.Application{
+		Metadata:      meta,
+		ClientID:      "orders-service",
+		TokenExchange: &application.TokenExchangePolicy{Audiences: []string{orders.Audience, billing.Audience}},
+	}
+
+	tests := []struct {
+		name    string
+		app     *application.Application
+		subject *token.Claims
+		apis    []*api.API
+		grants  []*grant.Grant
+		want    bool
+	}{
+		{name: "issued to the application", app: service, subject: ownToken, want: true},
+		{name: "issued to another client for a granted API", app: service, subject: userToken, apis: []*api.API{orders}, grants: []*grant.Grant{ordersGrant}, want: true},
+		{name: "issued to another client for a policy API", app: servingPolicy, subject: userToken, apis: []*api.API{orders}, want: true},
+		{name: "issued to another client for an API the application does not serve", app: service, subject: userToken, apis: []*api.API{orders}, grants: []*grant.Grant{billingGrant}, want: false},
+		{name: "issued to another client without a known API", app: service, subject: userToken, grants: []*grant.Grant{ordersGrant}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := canExchangeSubject(test.app, test.subject, test.apis, test.grants); got != test.want {
+				t.Fatalf("canExchangeSubject() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package oauth
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stevezaluk/simple-idp-lib/scope"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/token"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+/*
+UserInfo - The response of the userinfo endpoint, as defined in OpenID Connect Core Section 5.3.2
+*/
+type UserInfo struct {
+	token.UserClaims
+
+	// Subject - The ID of the user
+	Subject string `json:"sub"`
+}
+
+/*
+UserInfo - A server.HandlerFunc for the OpenID Connect userinfo endpoint. Should be registered
+under GET /userinfo. The access token must have been issued with the openid scope for an API
+using one of userinfoAlgorithms, and can be sent either as a bearer token or as a DPoP-bound token
+*/
+func (provider *Provider) UserInfo(service *server.Service) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		_, raw, _ := strings.Cut(c.GetHeader("Authorization"), " ")
+
+		claims, err := provider.verifier(service).VerifyRequest(c.Request, provider.userinfoAPIFor(strings.TrimSpace(raw)))
+		if err != nil {
+			if errors.Is(err, token.ErrMissingToken) {
+				abortBearer(c, http.StatusUnauthorized, "invalid_request", "An access token is required")
+				return
+			}
+
+			abortBearer(c, http.StatusUnauthorized, "invalid_token", "The access token is invalid")
+			return
+		}
+
+		scopes := scope.Parse(claims.Scope)
+		if !slices.Contains(scopes, "openid") {
+			abortBearer(c, http.StatusForbidden, "insufficient_scope", "The access token was not issued with the openid scope")
+			return
+		}
+
+		usr, err := user.GetUserByID(service.Database(), claims.Subject, true)
+		if err != nil {
+			if errors.Is(err, user.ErrUserDoesNotExist) {
+				abortBearer(c, http.StatusUnauthorized, "invalid_token", "The user no longer exists")
+				return
+			}
+
+			slog.Error("Failed to fetch user", "sub", claims.Subject, "err", err)
+			abort(c, errServerError())
+			return
+		}
+
+		c.Header("Cache-Control", "no-store")
+		c.JSON(http.StatusOK, &UserInfo{
+			UserClaims: *token.NewUserClaims(usr, scopes),
+			Subject:    usr.Metadata.Id,
+		})
+	}
+}
+
+/*
+abortBearer - Write a RFC 6750 Section 3 error response for requests to protected resources
+*/
+func abortBearer(c *gin.Context, status int, code string, description string) {
+	c.Header("WWW-Authenticate", `Bearer error="`+code+`", error_description="`+description+`"`)
+	c.AbortWithStatusJSON(status, &Error{Code: code, Description: description, Status: status})
+}
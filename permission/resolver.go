@@ -0,0 +1,122 @@
+package permission
+
+import (
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/role"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"slices"
+)
+
+/*
+Resolver - Computes the effective permissions of users. Roles and results are cached for the lifetime
+of the Resolver, so a new Resolver should be created for each request. A Resolver is not safe for
+concurrent use
+*/
+type Resolver struct {
+	// database - The database roles are loaded from
+	database *server.Database
+
+	// roles - Roles that have already been loaded, by Metadata.Id. Roles that do not exist are stored as nil
+	roles map[string]*role.Role
+
+	// results - Permissions that have already been resolved, by user and API
+	results map[resolution][]string
+}
+
+/*
+resolution - The key of a cached result
+*/
+type resolution struct {
+	user string
+	api  string
+}
+
+/*
+NewResolver - A constructor for the Resolver structure
+*/
+func NewResolver(database *server.Database) *Resolver {
+	return &Resolver{
+		database: database,
+		roles:    map[string]*role.Role{},
+		results:  map[resolution][]string{},
+	}
+}
+
+/*
+Resolve - Returns the names of the permissions of the API passed in the target parameter that have
+been assigned to the user, either directly or through one of their roles. The result is ready to be
+used for the permissions claim of tokens issued for APIs with AddPermissions set. Every role of the
+user that has not been loaded yet is fetched with a single query
+*/
+func (resolver *Resolver) Resolve(usr *user.User, target *api.API) ([]string, error) {
+	key := resolution{user: usr.Metadata.Id, api: target.Audience}
+	if cached, ok := resolver.results[key]; ok {
+		return cached, nil
+	}
+
+	err := resolver.loadRoles(usr.Roles)
+	if err != nil {
+		return nil, err
+	}
+
+	assigned := map[string]bool{}
+	for _, id := range usr.Permissions {
+		assigned[id] = true
+	}
+
+	for _, id := range usr.Roles {
+		assignedRole := resolver.roles[id]
+		if assignedRole == nil {
+			continue
+		}
+
+		for _, permission := range assignedRole.Permissions {
+			assigned[permission] = true
+		}
+	}
+
+	ret := []string{}
+	for _, permission := range target.Permissions {
+		if permission.Metadata != nil && assigned[permission.Metadata.Id] && !slices.Contains(ret, permission.Name) {
+			ret = append(ret, permission.Name)
+		}
+	}
+
+	resolver.results[key] = ret
+
+	return ret, nil
+}
+
+/*
+loadRoles - Fetch every role in the ids parameter that has not been loaded yet using a single query.
+Roles that no longer exist are cached as nil, so that they are not queried again
+*/
+func (resolver *Resolver) loadRoles(ids []string) error {
+	var missing []string
+
+	for _, id := range ids {
+		if _, ok := resolver.roles[id]; !ok && !slices.Contains(missing, id) {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	roles, err := role.GetRolesByIDs(resolver.database, missing)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range missing {
+		resolver.roles[id] = nil
+	}
+
+	for _, loaded := range roles {
+		resolver.roles[loaded.Metadata.Id] = loaded
+	}
+
+	return nil
+}
@@ -2,6 +2,8 @@ package rand
 
 import (
 	"crypto/rand"
+	"encoding/base64"
+	"math/big"
 )
 
 /*
@@ -17,3 +19,37 @@ func Seed(length int) ([]byte, error) {
 
 	return seed, nil
 }
+
+/*
+URLSafeString - Create a random string that is safe to include in URLs. The length parameter
+is the number of random bytes, not the length of the resulting string
+*/
+func URLSafeString(length int) (string, error) {
+	seed, err := Seed(length)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(seed), nil
+}
+
+/*
+FromAlphabet - Create a random string of the length passed in the length parameter, where each
+character is picked uniformly from the alphabet parameter. Useful for values that humans have
+to read and type, where a restricted alphabet avoids ambiguous characters
+*/
+func FromAlphabet(alphabet string, length int) (string, error) {
+	ret := make([]byte, length)
+	size := big.NewInt(int64(len(alphabet)))
+
+	for i := range ret {
+		index, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", err
+		}
+
+		ret[i] = alphabet[index.Int64()]
+	}
+
+	return string(ret), nil
+}
@@ -0,0 +1,180 @@
+package role
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrRoleAlreadyExists - Gets returned by CreateRole and ReplaceRole when another role already uses the same name
+var ErrRoleAlreadyExists = errors.New("role: Already exists")
+
+// ErrRoleDoesNotExist - Gets returned by GetRoleByName, GetRoleByID, ReplaceRole and DeleteRole when a role does not exist
+var ErrRoleDoesNotExist = errors.New("role: Does not exist")
+
+// ErrFetchRoleFailed - Serves as a wrapper around database errors for the GetRoleByName, GetRoleByID, GetRolesByIDs and ListRoles functions
+var ErrFetchRoleFailed = errors.New("role: Failed to fetch role")
+
+// ErrCreateRoleFailed - Serves as a wrapper around database errors for the CreateRole function
+var ErrCreateRoleFailed = errors.New("role: Failed to create role")
+
+// ErrReplaceRoleFailed - Serves as a wrapper around database errors for the ReplaceRole function
+var ErrReplaceRoleFailed = errors.New("role: Failed to replace role")
+
+// ErrDeleteRoleFailed - Serves as a wrapper around database errors for the DeleteRole function
+var ErrDeleteRoleFailed = errors.New("role: Failed to delete role")
+
+/*
+GetRoleByName - Fetch a role using its name
+*/
+func GetRoleByName(database *server.Database, name string) (*Role, error) {
+	var ret Role
+
+	err := database.Find("role", bson.M{"name": name}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchRoleFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+GetRoleByID - Fetch a role using its Metadata.Id
+*/
+func GetRoleByID(database *server.Database, id string) (*Role, error) {
+	var ret Role
+
+	err := database.Find("role", bson.M{"metadata.id": id}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRoleDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchRoleFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+CheckRoleExists - Check to see if a role with the name passed in the name parameter already exists in the database
+*/
+func CheckRoleExists(database *server.Database, name string) (bool, error) {
+	ok, err := database.Exists("role", bson.M{"name": name})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateRole - Insert a new role into the database, and return any errors that may occur. The name
+must be unique
+*/
+func CreateRole(database *server.Database, role *Role) error {
+	ok, err := CheckRoleExists(database, role.Name)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateRoleFailed, err)
+	}
+
+	if ok {
+		return ErrRoleAlreadyExists
+	}
+
+	err = database.Insert("role", role)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateRoleFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceRole - Replace a role with the model passed in the role parameter. The Metadata.Id of the model
+is used to signify which role to replace, so that its name can be changed as long as it stays unique
+*/
+func ReplaceRole(database *server.Database, role *Role) error {
+	ok, err := database.Exists("role", bson.M{"metadata.id": role.Metadata.Id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceRoleFailed, err)
+	}
+
+	if !ok {
+		return ErrRoleDoesNotExist
+	}
+
+	taken, err := database.Exists("role", bson.M{"name": role.Name, "metadata.id": bson.M{"$ne": role.Metadata.Id}})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceRoleFailed, err)
+	}
+
+	if taken {
+		return ErrRoleAlreadyExists
+	}
+
+	err = database.Replace("role", bson.M{"metadata.id": role.Metadata.Id}, role)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceRoleFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteRole - Remove a single role from the database using its name
+*/
+func DeleteRole(database *server.Database, name string) error {
+	ok, err := CheckRoleExists(database, name)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteRoleFailed, err)
+	}
+
+	if !ok {
+		return ErrRoleDoesNotExist
+	}
+
+	err = database.Delete("role", bson.M{"name": name})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteRoleFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ListRoles - Fetch all roles that are stored in the database
+*/
+func ListRoles(database *server.Database) ([]*Role, error) {
+	var ret []*Role
+
+	err := database.FindMany("role", bson.M{}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchRoleFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+GetRolesByIDs - Fetch every role whose Metadata.Id is passed in the ids parameter using a single
+query. Roles that do not exist are skipped, so fewer roles than ids may be returned
+*/
+func GetRolesByIDs(database *server.Database, ids []string) ([]*Role, error) {
+	var ret []*Role
+
+	if len(ids) == 0 {
+		return ret, nil
+	}
+
+	err := database.FindMany("role", bson.M{"metadata.id": bson.M{"$in": ids}}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchRoleFailed, err)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,161 @@
+package scope
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ErrScopeAlreadyExists - Gets returned by CreateScope and ReplaceScope when another scope already uses the same name
+var ErrScopeAlreadyExists = errors.New("scope: Already exists")
+
+// ErrScopeDoesNotExist - Gets returned by GetScopeByName, GetScopeByID, ReplaceScope and DeleteScope when a scope does not exist
+var ErrScopeDoesNotExist = errors.New("scope: Does not exist")
+
+// ErrFetchScopeFailed - Serves as a wrapper around database errors for the GetScopeByName, GetScopeByID and ListScopes functions
+var ErrFetchScopeFailed = errors.New("scope: Failed to fetch scope")
+
+// ErrCreateScopeFailed - Serves as a wrapper around database errors for the CreateScope function
+var ErrCreateScopeFailed = errors.New("scope: Failed to create scope")
+
+// ErrReplaceScopeFailed - Serves as a wrapper around database errors for the ReplaceScope function
+var ErrReplaceScopeFailed = errors.New("scope: Failed to replace scope")
+
+// ErrDeleteScopeFailed - Serves as a wrapper around database errors for the DeleteScope function
+var ErrDeleteScopeFailed = errors.New("scope: Failed to delete scope")
+
+/*
+ListScopes - Fetch all scopes that are stored in the database
+*/
+func ListScopes(database *server.Database) ([]*Scope, error) {
+	var ret []*Scope
+
+	err := database.FindMany("scope", bson.M{}, &ret)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchScopeFailed, err)
+	}
+
+	return ret, nil
+}
+
+/*
+GetScopeByName - Fetch a scope using its name
+*/
+func GetScopeByName(database *server.Database, name string) (*Scope, error) {
+	var ret Scope
+
+	err := database.Find("scope", bson.M{"name": name}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrScopeDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchScopeFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+GetScopeByID - Fetch a scope using its Metadata.Id
+*/
+func GetScopeByID(database *server.Database, id string) (*Scope, error) {
+	var ret Scope
+
+	err := database.Find("scope", bson.M{"metadata.id": id}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrScopeDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchScopeFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+CheckScopeExists - Check to see if a scope with the name passed in the name parameter already exists in the database
+*/
+func CheckScopeExists(database *server.Database, name string) (bool, error) {
+	ok, err := database.Exists("scope", bson.M{"name": name})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
+
+/*
+CreateScope - Insert a new scope into the database, and return any errors that may occur. The name
+must be unique
+*/
+func CreateScope(database *server.Database, scope *Scope) error {
+	ok, err := CheckScopeExists(database, scope.Name)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateScopeFailed, err)
+	}
+
+	if ok {
+		return ErrScopeAlreadyExists
+	}
+
+	err = database.Insert("scope", scope)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrCreateScopeFailed, err)
+	}
+
+	return nil
+}
+
+/*
+ReplaceScope - Replace a scope with the model passed in the scope parameter. The Metadata.Id of the model
+is used to signify which scope to replace, so that its name can be changed as long as it stays unique
+*/
+func ReplaceScope(database *server.Database, scope *Scope) error {
+	ok, err := database.Exists("scope", bson.M{"metadata.id": scope.Metadata.Id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceScopeFailed, err)
+	}
+
+	if !ok {
+		return ErrScopeDoesNotExist
+	}
+
+	taken, err := database.Exists("scope", bson.M{"name": scope.Name, "metadata.id": bson.M{"$ne": scope.Metadata.Id}})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceScopeFailed, err)
+	}
+
+	if taken {
+		return ErrScopeAlreadyExists
+	}
+
+	err = database.Replace("scope", bson.M{"metadata.id": scope.Metadata.Id}, scope)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrReplaceScopeFailed, err)
+	}
+
+	return nil
+}
+
+/*
+DeleteScope - Remove a single scope from the database using its name
+*/
+func DeleteScope(database *server.Database, name string) error {
+	ok, err := CheckScopeExists(database, name)
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteScopeFailed, err)
+	}
+
+	if !ok {
+		return ErrScopeDoesNotExist
+	}
+
+	err = database.Delete("scope", bson.M{"name": name})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrDeleteScopeFailed, err)
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package scope
 
 import (
 	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"strings"
 )
 
 /*
@@ -33,3 +34,18 @@ func New(name string, description string) (*Scope, error) {
 		Description: description,
 	}, nil
 }
+
+/*
+Parse - Split a space delimited scope parameter, as defined in RFC 6749 Section 3.3,
+into the names of each scope
+*/
+func Parse(raw string) []string {
+	return strings.Fields(raw)
+}
+
+/*
+Format - Join a list of scope names into a space delimited scope parameter
+*/
+func Format(names []string) string {
+	return strings.Join(names, " ")
+}
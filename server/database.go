@@ -147,6 +147,24 @@ func (database *Database) Find(collection string, query bson.M, model interface{
 	return nil
 }
 
+/*
+FindMany - Fetch all documents matching the query from MongoDB and decode the results into
+the slice reference passed in the models parameter
+*/
+func (database *Database) FindMany(collection string, query bson.M, models interface{}) error {
+	cursor, err := database.database.Collection(collection).Find(context.Background(), query)
+	if err != nil {
+		return err
+	}
+
+	err = cursor.All(context.Background(), models)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
 /*
 Exists - Check to see if a document exists from within the database
 */
@@ -199,3 +217,62 @@ func (database *Database) Delete(collection string, query bson.M) error {
 
 	return nil
 }
+
+/*
+Update - Apply the update operators passed in the update parameter to a single document in
+the MongoDB collection. Unlike Replace, only the fields referenced by the update are modified
+*/
+func (database *Database) Update(collection string, query bson.M, update bson.M) error {
+	_, err := database.database.Collection(collection).UpdateOne(context.Background(), query, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+FindAndUpdate - Atomically apply an update to a single document and decode the updated
+document into the reference passed in the model parameter. Returns mongo.ErrNoDocuments
+if no document matched the query
+*/
+func (database *Database) FindAndUpdate(collection string, query bson.M, update bson.M, model interface{}) error {
+	findOpts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	err := database.database.Collection(collection).FindOneAndUpdate(context.Background(), query, update, findOpts).Decode(model)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+CreateTTLIndex - Create a TTL index on the field passed in the field parameter. MongoDB removes
+documents once the date stored in this field has passed. The field must be stored as a BSON date
+*/
+func (database *Database) CreateTTLIndex(collection string, field string) error {
+	index := mongo.IndexModel{
+		Keys:    bson.D{{Key: field, Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+
+	_, err := database.database.Collection(collection).Indexes().CreateOne(context.Background(), index)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+/*
+DeleteMany - Remove every document matching the query from the MongoDB collection
+*/
+func (database *Database) DeleteMany(collection string, query bson.M) error {
+	_, err := database.database.Collection(collection).DeleteMany(context.Background(), query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
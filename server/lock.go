@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"time"
+)
+
+/*
+AcquireLock - Attempt to take a named lock that is shared between every Service connected
+to the same database. The lock is held by owner until ReleaseLock is called or the ttl elapses,
+whichever comes first. Returns true if the lock was acquired
+*/
+func (database *Database) AcquireLock(name string, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+
+	/*
+		The filter only matches the lock document if we already own it, or if the
+		previous owner let it expire. If neither is true, the upsert attempts to insert
+		a second document with the same _id, which fails with a duplicate key error
+	*/
+	filter := bson.M{
+		"_id": name,
+		"$or": bson.A{
+			bson.M{"owner": owner},
+			bson.M{"expires_at": bson.M{"$lt": now.UnixNano()}},
+		},
+	}
+
+	update := bson.M{
+		"$set": bson.M{
+			"owner":      owner,
+			"expires_at": now.Add(ttl).UnixNano(),
+		},
+	}
+
+	_, err := database.database.Collection("lock").UpdateOne(
+		context.Background(),
+		filter,
+		update,
+		options.UpdateOne().SetUpsert(true),
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+/*
+ReleaseLock - Release a named lock. Nothing happens if the lock is not held by owner
+*/
+func (database *Database) ReleaseLock(name string, owner string) error {
+	_, err := database.database.Collection("lock").DeleteOne(context.Background(), bson.M{"_id": name, "owner": owner})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -2,8 +2,10 @@ package server
 
 import (
 	"context"
+	"crypto/x509"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+	"net/http"
 	"strconv"
 )
 
@@ -26,6 +28,18 @@ type Service struct {
 
 	// database - The MongoDB database that this Service is connected to
 	database *Database
+
+	// certFile - The path to the PEM encoded TLS certificate. The Service is served over plain HTTP if this is empty
+	certFile string
+
+	// keyFile - The path to the PEM encoded private key of the TLS certificate
+	keyFile string
+
+	// clientCAFile - The path to the PEM encoded certificate authorities that client certificates are verified against
+	clientCAFile string
+
+	// clientCAs - The certificate authorities loaded from clientCAFile
+	clientCAs *x509.CertPool
 }
 
 /*
@@ -45,14 +59,25 @@ func New(name string, port int, database *Database) *Service {
 
 /*
 FromConfig - A wrapper around New. Constructs a new Service
-struct using values provided by Viper
+struct using values provided by Viper. TLS is enabled if
+tls.cert_file is set
 */
 func FromConfig() *Service {
-	return New(
+	service := New(
 		viper.GetString("name"),
 		viper.GetInt("port"),
 		NewDatabaseFromConfig(),
 	)
+
+	if viper.IsSet("tls.cert_file") {
+		service.SetTLS(
+			viper.GetString("tls.cert_file"),
+			viper.GetString("tls.key_file"),
+			viper.GetString("tls.client_ca_file"),
+		)
+	}
+
+	return service
 }
 
 /*
@@ -76,7 +101,24 @@ in here should eventually be deprecated so it can gracefully shutdown. Gin doesn
 provide a way natively within its framework to gracefully stop accepting connections
 */
 func (service *Service) Run() error {
-	err := service.router.Run("0.0.0.0:" + strconv.Itoa(service.Port))
+	address := "0.0.0.0:" + strconv.Itoa(service.Port)
+
+	if service.certFile != "" {
+		err := service.loadClientCAs()
+		if err != nil {
+			return err
+		}
+
+		server := &http.Server{
+			Addr:      address,
+			Handler:   service.router,
+			TLSConfig: service.tlsConfig(),
+		}
+
+		return server.ListenAndServeTLS(service.certFile, service.keyFile)
+	}
+
+	err := service.router.Run(address)
 	if err != nil {
 		return err
 	}
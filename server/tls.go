@@ -0,0 +1,89 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"os"
+)
+
+// ErrInvalidClientCAFile - Gets returned by Service.Run when the client CA file does not contain any PEM encoded certificates
+var ErrInvalidClientCAFile = errors.New("server: Client CA file does not contain any certificates")
+
+/*
+SetTLS - Serve the API over HTTPS using the certificate and private key passed in the certFile and
+keyFile parameters. Client certificates are requested during the handshake but are not required or
+verified, as self-signed certificates are allowed for some applications. Handlers should use
+ClientCertificate and ClientCAs to decide whether a certificate is trusted. If clientCAFile is
+empty, no certificate authorities are trusted
+*/
+func (service *Service) SetTLS(certFile string, keyFile string, clientCAFile string) {
+	service.certFile = certFile
+	service.keyFile = keyFile
+	service.clientCAFile = clientCAFile
+}
+
+/*
+TLSEnabled - Returns true if SetTLS was called, and the Service is served over HTTPS
+*/
+func (service *Service) TLSEnabled() bool {
+	return service.certFile != ""
+}
+
+/*
+loadClientCAs - Read the certificate authorities from the client CA file, if one was provided
+*/
+func (service *Service) loadClientCAs() error {
+	service.clientCAs = x509.NewCertPool()
+
+	if service.clientCAFile == "" {
+		return nil
+	}
+
+	encoded, err := os.ReadFile(service.clientCAFile)
+	if err != nil {
+		return err
+	}
+
+	if !service.clientCAs.AppendCertsFromPEM(encoded) {
+		return ErrInvalidClientCAFile
+	}
+
+	return nil
+}
+
+/*
+ClientCAs - Getter function for the certificate authorities that client certificates are
+verified against. Returns an empty pool if TLS has not been configured
+*/
+func (service *Service) ClientCAs() *x509.CertPool {
+	if service.clientCAs == nil {
+		return x509.NewCertPool()
+	}
+
+	return service.clientCAs
+}
+
+/*
+tlsConfig - Build the TLS configuration the Service is served with
+*/
+func (service *Service) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequestClientCert,
+	}
+}
+
+/*
+ClientCertificate - Returns the certificate the client presented during the TLS handshake, or
+nil if the request was not made over TLS or no certificate was presented. The certificate has
+not been verified
+*/
+func ClientCertificate(c *gin.Context) *x509.Certificate {
+	if c.Request.TLS == nil || len(c.Request.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+
+	return c.Request.TLS.PeerCertificates[0]
+}
@@ -0,0 +1,83 @@
+package token
+
+import (
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/server"
+)
+
+/*
+Sign - Sign the claims passed in the claims parameter using the private half of an
+asymmetric key. The kid of the key is embedded in the header of the token so that
+resource servers can select the correct key from the JWK Set
+*/
+func Sign(claims jwt.Claims, signingKey *key.Key) (string, error) {
+	return SignWithType(claims, signingKey, "JWT")
+}
+
+/*
+SignWithType - A wrapper around Sign that sets the typ header of the token to the value
+passed in the typ parameter. Used for tokens that have an explicit media type
+*/
+func SignWithType(claims jwt.Claims, signingKey *key.Key, typ string) (string, error) {
+	method, err := signingKey.SigningMethod()
+	if err != nil {
+		return "", err
+	}
+
+	signer, err := signingKey.Signer()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = signingKey.KeyID
+	token.Header["typ"] = typ
+
+	return token.SignedString(signer)
+}
+
+/*
+SignForAPI - Sign the claims using the algorithm configured on the API. HS256 tokens are
+signed with the API's signing secret, while all other algorithms use the current signing key
+*/
+func SignForAPI(database *server.Database, claims *Claims, target *api.API) (string, error) {
+	if target.TokenType == api.HS256 {
+		return SignHS256(claims, target)
+	}
+
+	signingKey, err := key.GetSigningKey(database, target.TokenType)
+	if err != nil {
+		return "", err
+	}
+
+	return Sign(claims, signingKey)
+}
+
+/*
+asymmetricKey - Fetch the public key referenced by the kid header of the token. The
+algorithm of the stored key must match the algorithm the API issues tokens with, and
+the key cannot have been revoked
+*/
+func asymmetricKey(database *server.Database, token *jwt.Token, algorithm api.TokenType) (interface{}, error) {
+	keyId, ok := token.Header["kid"].(string)
+	if !ok {
+		return nil, ErrInvalidSignature
+	}
+
+	verificationKey, err := key.GetKey(database, keyId)
+	if err != nil {
+		return nil, err
+	}
+
+	if verificationKey.Algorithm != algorithm {
+		return nil, ErrInvalidAlgorithm
+	}
+
+	if !verificationKey.CanVerify() {
+		return nil, key.ErrKeyRevoked
+	}
+
+	return verificationKey.Public()
+}
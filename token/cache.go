@@ -0,0 +1,117 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultRevocationCacheTTL - How long a jti that was found to not be revoked is trusted before the deny list is checked again
+const DefaultRevocationCacheTTL = 30 * time.Second
+
+/*
+revocationCache - An in-process cache in front of the deny list, so that verifying a token
+does not require a database round trip on every call. Revocations are permanent, so revoked
+entries are kept until the token expires. Entries for tokens that were not revoked record when
+the deny list was checked, and each Verifier decides how long it trusts them for using its
+RevocationCacheTTL. This bounds how long a revocation made by another instance of simple-idp
+can take to be noticed
+*/
+type revocationCache struct {
+	// revoked - Maps the jti of revoked tokens to the expiration of the token
+	revoked map[string]time.Time
+
+	// allowed - Maps the jti of tokens that were not revoked to the time the deny list was checked
+	allowed map[string]time.Time
+
+	// retention - The longest TTL an entry in the allowed map has been stored with. Older entries are pruned
+	retention time.Duration
+
+	// pruned - The last time expired entries were removed from the cache
+	pruned time.Time
+
+	lock sync.RWMutex
+}
+
+// revocations - The revocationCache shared by every Verifier in the process
+var revocations = newRevocationCache()
+
+/*
+newRevocationCache - A constructor for the revocationCache structure
+*/
+func newRevocationCache() *revocationCache {
+	return &revocationCache{
+		revoked: make(map[string]time.Time),
+		allowed: make(map[string]time.Time),
+		pruned:  time.Now().UTC(),
+	}
+}
+
+/*
+lookup - Returns whether the jti passed in the id parameter has been revoked. The second return
+value is false if the cache holds no entry for the jti that can be trusted for the ttl passed in
+the ttl parameter
+*/
+func (cache *revocationCache) lookup(id string, ttl time.Duration) (bool, bool) {
+	cache.lock.RLock()
+	defer cache.lock.RUnlock()
+
+	now := time.Now().UTC()
+
+	if expiresAt, ok := cache.revoked[id]; ok && now.Before(expiresAt) {
+		return true, true
+	}
+
+	if checkedAt, ok := cache.allowed[id]; ok && now.Before(checkedAt.Add(ttl)) {
+		return false, true
+	}
+
+	return false, false
+}
+
+/*
+store - Record the result of a deny list lookup for the jti passed in the id parameter. The
+expiresAt parameter is only used for revoked tokens, and the ttl parameter is only used for
+tokens that were not revoked. A ttl of zero means the result is not cached
+*/
+func (cache *revocationCache) store(id string, revoked bool, expiresAt time.Time, ttl time.Duration) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	now := time.Now().UTC()
+	cache.prune(now)
+
+	if revoked {
+		delete(cache.allowed, id)
+		cache.revoked[id] = expiresAt
+		return
+	}
+
+	if ttl > 0 {
+		cache.allowed[id] = now
+		cache.retention = max(cache.retention, ttl)
+	}
+}
+
+/*
+prune - Remove expired entries from the cache. This runs at most once per minute, and the
+caller is expected to hold the write lock
+*/
+func (cache *revocationCache) prune(now time.Time) {
+	if now.Sub(cache.pruned) < time.Minute {
+		return
+	}
+
+	for id, expiresAt := range cache.revoked {
+		if !now.Before(expiresAt) {
+			delete(cache.revoked, id)
+		}
+	}
+
+	for id, checkedAt := range cache.allowed {
+		if !now.Before(checkedAt.Add(cache.retention)) {
+			delete(cache.allowed, id)
+		}
+	}
+
+	cache.pruned = now
+}
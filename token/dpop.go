@@ -0,0 +1,333 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDPoPProof - Gets returned by VerifyDPoPProof when a DPoP proof is malformed, or does not match the request it was sent with
+var ErrInvalidDPoPProof = errors.New("token: DPoP proof is invalid")
+
+// ErrDPoPProofReplayed - Gets returned by VerifyDPoPProof when the jti of a DPoP proof has already been used
+var ErrDPoPProofReplayed = errors.New("token: DPoP proof has already been used")
+
+// ErrDPoPBindingMismatch - Gets returned when a DPoP proof was signed by a different key than the one a token is bound to
+var ErrDPoPBindingMismatch = errors.New("token: DPoP proof does not match the key the token is bound to")
+
+// ErrMissingToken - Gets returned by Verifier.VerifyRequest when a request has no access token
+var ErrMissingToken = errors.New("token: Request does not contain an access token")
+
+// DPoPProofLifetime - How long after its iat a DPoP proof is accepted for, not including the leeway
+const DPoPProofLifetime = time.Minute
+
+// DPoPAlgorithms - The algorithms DPoP proofs can be signed with. Only asymmetric algorithms are accepted
+var DPoPAlgorithms = []string{string(api.RS256), string(api.ES256), string(api.EdDSA)}
+
+// privateJWKMembers - Members of a JWK that only appear in private keys, which must never be sent in a DPoP proof
+var privateJWKMembers = []string{"d", "p", "q", "dp", "dq", "qi", "k"}
+
+/*
+Confirmation - The cnf claim defined in RFC 7800. Binds a token to a key, so that only the holder
+of the key can use it
+*/
+type Confirmation struct {
+	// JWKThumbprint - The RFC 7638 thumbprint of the DPoP key the token is bound to
+	JWKThumbprint string `json:"jkt,omitempty" bson:"jkt,omitempty"`
+
+	// CertificateThumbprint - The RFC 8705 thumbprint of the client certificate the token is bound to
+	CertificateThumbprint string `json:"x5t#S256,omitempty" bson:"x5t_s256,omitempty"`
+}
+
+/*
+Matches - Returns true if every binding of the confirmation is satisfied by the confirmation passed
+in the presented parameter, which describes the keys the request was made with
+*/
+func (confirmation *Confirmation) Matches(presented *Confirmation) bool {
+	if confirmation == nil {
+		return true
+	}
+
+	if presented == nil {
+		presented = &Confirmation{}
+	}
+
+	if confirmation.JWKThumbprint != "" && confirmation.JWKThumbprint != presented.JWKThumbprint {
+		return false
+	}
+
+	if confirmation.CertificateThumbprint != "" && confirmation.CertificateThumbprint != presented.CertificateThumbprint {
+		return false
+	}
+
+	return true
+}
+
+/*
+DPoPClaims - The claims of a DPoP proof JWT, as defined in RFC 9449 Section 4.2
+*/
+type DPoPClaims struct {
+	jwt.RegisteredClaims
+
+	// Method - The HTTP method of the request the proof was created for
+	Method string `json:"htm"`
+
+	// URI - The HTTP URI of the request the proof was created for, without query and fragment
+	URI string `json:"htu"`
+
+	// AccessTokenHash - The base64url encoded SHA-256 hash of the access token sent with the proof
+	AccessTokenHash string `json:"ath,omitempty"`
+}
+
+/*
+usedDPoPProof - An entry in the DPoP replay cache. The ID is derived from the key and the jti
+of the proof, so two clients can never collide
+*/
+type usedDPoPProof struct {
+	// ID - The hex encoded SHA-256 hash of the thumbprint and jti of the proof
+	ID string `bson:"_id"`
+
+	// ExpiresAt - The time after which the proof would be rejected anyway. MongoDB removes the entry after this
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+/*
+proofStore - Where used DPoP proofs are recorded. Inserting a proof that has already been recorded
+must fail with a duplicate key error. Satisfied by server.Database
+*/
+type proofStore interface {
+	Insert(collection string, model interface{}) error
+}
+
+/*
+AccessTokenHash - Computes the ath claim of a DPoP proof for the access token passed in the accessToken parameter
+*/
+func AccessTokenHash(accessToken string) string {
+	digest := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+/*
+VerifyDPoPProof - Validate a DPoP proof sent with a request, as described in RFC 9449 Section 4.3.
+The method and uri parameters describe the request the proof was sent with. If the proof is sent
+alongside an access token, it must be passed in the accessToken parameter so that the ath claim
+can be validated. Each proof is only accepted once. The RFC 7638 thumbprint of the key the proof
+was signed with is returned
+*/
+func VerifyDPoPProof(database *server.Database, raw string, method string, uri string, accessToken string, leeway time.Duration) (string, error) {
+	return verifyDPoPProof(database, raw, method, uri, accessToken, leeway)
+}
+
+/*
+verifyDPoPProof - The implementation of VerifyDPoPProof, recording used proofs in the proofStore
+passed in the proofs parameter
+*/
+func verifyDPoPProof(proofs proofStore, raw string, method string, uri string, accessToken string, leeway time.Duration) (string, error) {
+	var claims DPoPClaims
+	var thumbprint string
+
+	parser := jwt.NewParser(jwt.WithValidMethods(DPoPAlgorithms), jwt.WithLeeway(leeway))
+
+	_, err := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		if typ, _ := token.Header["typ"].(string); typ != "dpop+jwt" {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		members, ok := token.Header["jwk"].(map[string]interface{})
+		if !ok {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		for _, name := range privateJWKMembers {
+			if _, ok := members[name]; ok {
+				return nil, ErrInvalidDPoPProof
+			}
+		}
+
+		encoded, err := json.Marshal(members)
+		if err != nil {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		var jwk key.JWK
+
+		err = json.Unmarshal(encoded, &jwk)
+		if err != nil {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		thumbprint, err = jwk.Thumbprint()
+		if err != nil {
+			return nil, ErrInvalidDPoPProof
+		}
+
+		return jwk.PublicKey()
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: (%s)", ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return "", ErrInvalidDPoPProof
+	}
+
+	now := time.Now().UTC()
+	issuedAt := claims.IssuedAt.Time
+
+	if issuedAt.After(now.Add(leeway)) || issuedAt.Before(now.Add(-DPoPProofLifetime-leeway)) {
+		return "", ErrInvalidDPoPProof
+	}
+
+	if claims.Method != method || !sameDPoPURI(claims.URI, uri) {
+		return "", ErrInvalidDPoPProof
+	}
+
+	if accessToken != "" && claims.AccessTokenHash != AccessTokenHash(accessToken) {
+		return "", ErrInvalidDPoPProof
+	}
+
+	digest := sha256.Sum256([]byte(thumbprint + ":" + claims.ID))
+
+	err = proofs.Insert("dpop_proof", &usedDPoPProof{
+		ID:        hex.EncodeToString(digest[:]),
+		ExpiresAt: issuedAt.Add(DPoPProofLifetime + leeway),
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return "", ErrDPoPProofReplayed
+		}
+		return "", fmt.Errorf("%w: (%s)", ErrInvalidDPoPProof, err)
+	}
+
+	return thumbprint, nil
+}
+
+/*
+sameDPoPURI - Compare the htu claim of a DPoP proof with the URI of the request. The query and
+fragment are ignored, and the scheme and host are compared case insensitively
+*/
+func sameDPoPURI(htu string, uri string) bool {
+	normalize := func(raw string) (string, bool) {
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return "", false
+		}
+
+		return strings.ToLower(parsed.Scheme) + "://" + strings.ToLower(parsed.Host) + parsed.EscapedPath(), true
+	}
+
+	left, ok := normalize(htu)
+	if !ok {
+		return false
+	}
+
+	right, ok := normalize(uri)
+	if !ok {
+		return false
+	}
+
+	return left == right
+}
+
+/*
+RequestURL - Reconstruct the absolute URL of an incoming request, without its query. The scheme
+is taken from the X-Forwarded-Proto header if the request was forwarded by a proxy terminating TLS
+*/
+func RequestURL(req *http.Request) string {
+	scheme := "http"
+	if req.TLS != nil || strings.EqualFold(req.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+
+	return scheme + "://" + req.Host + req.URL.EscapedPath()
+}
+
+/*
+DPoPHeader - Returns the DPoP proof sent with a request. An error is returned if more than one
+proof was sent, as RFC 9449 forbids this
+*/
+func DPoPHeader(req *http.Request) (string, error) {
+	values := req.Header.Values("DPoP")
+
+	switch len(values) {
+	case 0:
+		return "", nil
+	case 1:
+		return values[0], nil
+	}
+
+	return "", ErrInvalidDPoPProof
+}
+
+/*
+VerifyRequest - Authenticate a request made to a resource server built on server.Service, for
+example by passing c.Request from a gin handler. Both Bearer and DPoP access tokens are accepted,
+but tokens bound to a DPoP key must be sent with the DPoP scheme and a valid proof for the request.
+Tokens bound to a client certificate must be sent over a TLS connection using that certificate
+*/
+func (verifier *Verifier) VerifyRequest(req *http.Request, target *api.API) (*Claims, error) {
+	scheme, raw, ok := strings.Cut(req.Header.Get("Authorization"), " ")
+	raw = strings.TrimSpace(raw)
+	if !ok || raw == "" {
+		return nil, ErrMissingToken
+	}
+
+	claims, err := verifier.Verify(raw, target)
+	if err != nil {
+		return nil, err
+	}
+
+	err = verifyCertificateBinding(req, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	bound := claims.Confirmation != nil && claims.Confirmation.JWKThumbprint != ""
+
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		if bound {
+			return nil, ErrDPoPBindingMismatch
+		}
+
+		return claims, nil
+	case strings.EqualFold(scheme, "DPoP"):
+		if !bound {
+			return nil, ErrDPoPBindingMismatch
+		}
+	default:
+		return nil, ErrMissingToken
+	}
+
+	proof, err := DPoPHeader(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if proof == "" {
+		return nil, ErrInvalidDPoPProof
+	}
+
+	thumbprint, err := verifyDPoPProof(verifier.proofs, proof, req.Method, RequestURL(req), raw, verifier.Leeway)
+	if err != nil {
+		return nil, err
+	}
+
+	if thumbprint != claims.Confirmation.JWKThumbprint {
+		return nil, ErrDPoPBindingMismatch
+	}
+
+	return claims, nil
+}
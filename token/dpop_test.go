@@ -0,0 +1,445 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/key"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testResource - The URL of the resource server requests are made to in tests
+const testResource = "https://api.example.com/resource"
+
+/*
+memoryProofStore - A proofStore that keeps used proofs in memory, and fails with a duplicate key
+error when the same proof is recorded twice, like the unique _id index in MongoDB
+*/
+type memoryProofStore struct {
+	used map[string]bool
+	lock sync.Mutex
+}
+
+func (store *memoryProofStore) Insert(collection string, model interface{}) error {
+	store.lock.Lock()
+	defer store.lock.Unlock()
+
+	proof := model.(*usedDPoPProof)
+	if store.used[proof.ID] {
+		return mongo.WriteException{WriteErrors: []mongo.WriteError{{Code: 11000, Message: "duplicate key"}}}
+	}
+
+	store.used[proof.ID] = true
+
+	return nil
+}
+
+/*
+dpopKey - A key pair that DPoP proofs are signed with in tests
+*/
+type dpopKey struct {
+	private    *ecdsa.PrivateKey
+	members    map[string]interface{}
+	thumbprint string
+}
+
+/*
+newDPoPKey - Generate a P-256 key pair, and the public JWK that is embedded in the header of each proof
+*/
+func newDPoPKey(t *testing.T) *dpopKey {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jwk, err := key.NewJWK(&private.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var members map[string]interface{}
+
+	err = json.Unmarshal(encoded, &members)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &dpopKey{private: private, members: members, thumbprint: thumbprint}
+}
+
+/*
+proof - Sign a DPoP proof with the key. The modify function can be used to change the header or the
+claims before the proof is signed
+*/
+func (dpop *dpopKey) proof(t *testing.T, method string, uri string, accessToken string, modify func(header map[string]interface{}, claims *DPoPClaims)) string {
+	t.Helper()
+
+	claims := &DPoPClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       uuid.NewString(),
+			IssuedAt: jwt.NewNumericDate(time.Now()),
+		},
+		Method: method,
+		URI:    uri,
+	}
+
+	if accessToken != "" {
+		claims.AccessTokenHash = AccessTokenHash(accessToken)
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	unsigned.Header["typ"] = "dpop+jwt"
+	unsigned.Header["jwk"] = dpop.members
+
+	if modify != nil {
+		modify(unsigned.Header, claims)
+	}
+
+	signed, err := unsigned.SignedString(dpop.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func TestSameDPoPURI(t *testing.T) {
+	tests := []struct {
+		name string
+		htu  string
+		uri  string
+		want bool
+	}{
+		{name: "identical", htu: "https://idp.example.com/oauth/token", uri: "https://idp.example.com/oauth/token", want: true},
+		{name: "query ignored", htu: "https://idp.example.com/oauth/token?a=b", uri: "https://idp.example.com/oauth/token", want: true},
+		{name: "fragment ignored", htu: "https://idp.example.com/oauth/token#x", uri: "https://idp.example.com/oauth/token", want: true},
+		{name: "scheme and host case", htu: "HTTPS://IDP.example.com/oauth/token", uri: "https://idp.example.com/oauth/token", want: true},
+		{name: "path case", htu: "https://idp.example.com/OAuth/token", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "different path", htu: "https://idp.example.com/oauth/revoke", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "trailing slash", htu: "https://idp.example.com/oauth/token/", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "different scheme", htu: "http://idp.example.com/oauth/token", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "different host", htu: "https://evil.example.com/oauth/token", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "different port", htu: "https://idp.example.com:8443/oauth/token", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "encoded path", htu: "https://idp.example.com/oauth/%74oken", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "relative htu", htu: "/oauth/token", uri: "https://idp.example.com/oauth/token", want: false},
+		{name: "empty htu", htu: "", uri: "https://idp.example.com/oauth/token", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := sameDPoPURI(test.htu, test.uri); got != test.want {
+				t.Fatalf("sameDPoPURI(%q, %q) = %v, want %v", test.htu, test.uri, got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfirmationMatches(t *testing.T) {
+	tests := []struct {
+		name         string
+		confirmation *Confirmation
+		presented    *Confirmation
+		want         bool
+	}{
+		{name: "unbound", confirmation: nil, presented: nil, want: true},
+		{name: "unbound with key", confirmation: nil, presented: &Confirmation{JWKThumbprint: "a"}, want: true},
+		{name: "dpop match", confirmation: &Confirmation{JWKThumbprint: "a"}, presented: &Confirmation{JWKThumbprint: "a"}, want: true},
+		{name: "dpop mismatch", confirmation: &Confirmation{JWKThumbprint: "a"}, presented: &Confirmation{JWKThumbprint: "b"}, want: false},
+		{name: "dpop missing", confirmation: &Confirmation{JWKThumbprint: "a"}, presented: nil, want: false},
+		{name: "certificate match", confirmation: &Confirmation{CertificateThumbprint: "c"}, presented: &Confirmation{CertificateThumbprint: "c"}, want: true},
+		{name: "certificate mismatch", confirmation: &Confirmation{CertificateThumbprint: "c"}, presented: &Confirmation{CertificateThumbprint: "d"}, want: false},
+		{name: "certificate presented as dpop", confirmation: &Confirmation{CertificateThumbprint: "c"}, presented: &Confirmation{JWKThumbprint: "c"}, want: false},
+		{name: "both match", confirmation: &Confirmation{JWKThumbprint: "a", CertificateThumbprint: "c"}, presented: &Confirmation{JWKThumbprint: "a", CertificateThumbprint: "c"}, want: true},
+		{name: "both with only dpop", confirmation: &Confirmation{JWKThumbprint: "a", CertificateThumbprint: "c"}, presented: &Confirmation{JWKThumbprint: "a"}, want: false},
+		{name: "empty binding", confirmation: &Confirmation{}, presented: nil, want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.confirmation.Matches(test.presented); got != test.want {
+				t.Fatalf("Matches() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	dpop := newDPoPKey(t)
+
+	tests := []struct {
+		name        string
+		method      string
+		uri         string
+		accessToken string
+		modify      func(header map[string]interface{}, claims *DPoPClaims)
+		wantErr     error
+	}{
+		{name: "valid", method: http.MethodPost, uri: testResource},
+		{name: "valid with access token", method: http.MethodGet, uri: testResource, accessToken: "token"},
+		{
+			name: "wrong typ", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { header["typ"] = "JWT" },
+		},
+		{
+			name: "missing jwk", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { delete(header, "jwk") },
+		},
+		{
+			name: "private key in jwk", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) {
+				members := map[string]interface{}{"d": "secret"}
+				for name, value := range dpop.members {
+					members[name] = value
+				}
+				header["jwk"] = members
+			},
+		},
+		{
+			name: "wrong method", method: http.MethodGet, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { claims.Method = http.MethodPost },
+		},
+		{
+			name: "wrong htu", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { claims.URI = "https://api.example.com/other" },
+		},
+		{
+			name: "missing ath", method: http.MethodGet, uri: testResource, accessToken: "token", wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { claims.AccessTokenHash = "" },
+		},
+		{
+			name: "wrong ath", method: http.MethodGet, uri: testResource, accessToken: "token", wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) {
+				claims.AccessTokenHash = AccessTokenHash("other")
+			},
+		},
+		{
+			name: "missing jti", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) { claims.ID = "" },
+		},
+		{
+			name: "stale iat", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-2 * DPoPProofLifetime))
+			},
+		},
+		{
+			name: "future iat", method: http.MethodPost, uri: testResource, wantErr: ErrInvalidDPoPProof,
+			modify: func(header map[string]interface{}, claims *DPoPClaims) {
+				claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Minute))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := &memoryProofStore{used: map[string]bool{}}
+
+			raw := dpop.proof(t, test.method, test.uri, test.accessToken, test.modify)
+
+			thumbprint, err := verifyDPoPProof(store, raw, test.method, test.uri, test.accessToken, time.Second)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if thumbprint != dpop.thumbprint {
+				t.Fatalf("expected thumbprint %s, got %s", dpop.thumbprint, thumbprint)
+			}
+		})
+	}
+}
+
+func TestVerifyDPoPProofReplay(t *testing.T) {
+	store := &memoryProofStore{used: map[string]bool{}}
+	dpop := newDPoPKey(t)
+	other := newDPoPKey(t)
+
+	fixedJti := func(header map[string]interface{}, claims *DPoPClaims) { claims.ID = "jti-1" }
+
+	raw := dpop.proof(t, http.MethodPost, testResource, "", fixedJti)
+
+	_, err := verifyDPoPProof(store, raw, http.MethodPost, testResource, "", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = verifyDPoPProof(store, raw, http.MethodPost, testResource, "", time.Second)
+	if !errors.Is(err, ErrDPoPProofReplayed) {
+		t.Fatalf("expected ErrDPoPProofReplayed, got %v", err)
+	}
+
+	/*
+		The replay cache is keyed by the key and the jti, so another key reusing
+		the same jti is not treated as a replay
+	*/
+	reused := other.proof(t, http.MethodPost, testResource, "", fixedJti)
+
+	_, err = verifyDPoPProof(store, reused, http.MethodPost, testResource, "", time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error for a different key with the same jti: %v", err)
+	}
+}
+
+/*
+newTestVerifier - Build a Verifier that records DPoP proofs in memory, along with an HS256 API to
+issue tokens for. Tokens issued with issueTestToken are marked as not revoked in the revocation
+cache, so that verifying them does not need a database
+*/
+func newTestVerifier(t *testing.T) (*Verifier, *api.API) {
+	t.Helper()
+
+	target, err := api.New("Test API", "https://api.example.com", api.HS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifier := &Verifier{
+		Issuer:             "https://idp.example.com",
+		Leeway:             time.Second,
+		RevocationCacheTTL: time.Minute,
+		proofs:             &memoryProofStore{used: map[string]bool{}},
+	}
+
+	return verifier, target
+}
+
+/*
+issueTestToken - Sign an access token for the API bound to the confirmation passed in the confirmation parameter
+*/
+func issueTestToken(t *testing.T, verifier *Verifier, target *api.API, confirmation *Confirmation) string {
+	t.Helper()
+
+	claims, err := NewClaims(verifier.Issuer, "user-1", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims.Confirmation = confirmation
+
+	signed, err := SignHS256(claims, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revocations.store(claims.ID, false, time.Time{}, verifier.RevocationCacheTTL)
+
+	return signed
+}
+
+func TestVerifyRequestDPoP(t *testing.T) {
+	verifier, target := newTestVerifier(t)
+	dpop := newDPoPKey(t)
+	other := newDPoPKey(t)
+
+	bearer := issueTestToken(t, verifier, target, nil)
+	bound := issueTestToken(t, verifier, target, &Confirmation{JWKThumbprint: dpop.thumbprint})
+
+	tests := []struct {
+		name          string
+		authorization string
+		proof         func() string
+		wantErr       error
+	}{
+		{name: "bearer", authorization: "Bearer " + bearer},
+		{name: "bearer scheme is case insensitive", authorization: "bearer " + bearer},
+		{
+			name: "dpop", authorization: "DPoP " + bound,
+			proof: func() string { return dpop.proof(t, http.MethodGet, testResource, bound, nil) },
+		},
+		{name: "missing authorization", authorization: "", wantErr: ErrMissingToken},
+		{name: "unknown scheme", authorization: "Basic " + bearer, wantErr: ErrMissingToken},
+		{name: "bound token as bearer", authorization: "Bearer " + bound, wantErr: ErrDPoPBindingMismatch},
+		{
+			name: "bearer token as dpop", authorization: "DPoP " + bearer, wantErr: ErrDPoPBindingMismatch,
+			proof: func() string { return dpop.proof(t, http.MethodGet, testResource, bearer, nil) },
+		},
+		{name: "dpop without proof", authorization: "DPoP " + bound, wantErr: ErrInvalidDPoPProof},
+		{
+			name: "proof from another key", authorization: "DPoP " + bound, wantErr: ErrDPoPBindingMismatch,
+			proof: func() string { return other.proof(t, http.MethodGet, testResource, bound, nil) },
+		},
+		{
+			name: "proof for another token", authorization: "DPoP " + bound, wantErr: ErrInvalidDPoPProof,
+			proof: func() string { return dpop.proof(t, http.MethodGet, testResource, bearer, nil) },
+		},
+		{
+			name: "proof for another method", authorization: "DPoP " + bound, wantErr: ErrInvalidDPoPProof,
+			proof: func() string { return dpop.proof(t, http.MethodPost, testResource, bound, nil) },
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testResource, nil)
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+
+			if test.proof != nil {
+				req.Header.Set("DPoP", test.proof())
+			}
+
+			claims, err := verifier.VerifyRequest(req, target)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if claims.Subject != "user-1" {
+				t.Fatalf("unexpected subject %q", claims.Subject)
+			}
+		})
+	}
+}
+
+func TestVerifyRequestDPoPReplay(t *testing.T) {
+	verifier, target := newTestVerifier(t)
+	dpop := newDPoPKey(t)
+
+	bound := issueTestToken(t, verifier, target, &Confirmation{JWKThumbprint: dpop.thumbprint})
+	proof := dpop.proof(t, http.MethodGet, testResource, bound, nil)
+
+	for i, wantErr := range []error{nil, ErrDPoPProofReplayed} {
+		req := httptest.NewRequest(http.MethodGet, testResource, nil)
+		req.Header.Set("Authorization", "DPoP "+bound)
+		req.Header.Set("DPoP", proof)
+
+		_, err := verifier.VerifyRequest(req, target)
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("request %d: expected %v, got %v", i+1, wantErr, err)
+		}
+	}
+}
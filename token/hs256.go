@@ -0,0 +1,52 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stevezaluk/simple-idp-lib/api"
+)
+
+// minimumSigningSecretLength - The minimum length of a decoded HS256 signing secret, in bytes
+const minimumSigningSecretLength = 32
+
+// ErrInvalidSigningSecret - Gets returned when the signing secret of an HS256 API is missing, cannot be decoded or is shorter than 256 bits
+var ErrInvalidSigningSecret = errors.New("token: API signing secret is invalid")
+
+/*
+SignHS256 - Sign the claims passed in the claims parameter using the signing secret of the
+API that the token is being issued for. Returns the compact serialization of the token
+*/
+func SignHS256(claims *Claims, target *api.API) (string, error) {
+	if target.TokenType != api.HS256 {
+		return "", ErrInvalidAlgorithm
+	}
+
+	secret, err := hs256Secret(target)
+	if err != nil {
+		return "", err
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+}
+
+/*
+hs256Key - Returns the decoded signing secret of the API so that it can be used to
+verify the signature of a HS256 token
+*/
+func hs256Key(target *api.API) (interface{}, error) {
+	return hs256Secret(target)
+}
+
+/*
+hs256Secret - Decode the signing secret of the API. An empty or short secret would let anyone
+forge tokens for the API, so ErrInvalidSigningSecret is returned instead
+*/
+func hs256Secret(target *api.API) ([]byte, error) {
+	secret, err := base64.URLEncoding.DecodeString(target.SigningSecret)
+	if err != nil || len(secret) < minimumSigningSecretLength {
+		return nil, ErrInvalidSigningSecret
+	}
+
+	return secret, nil
+}
@@ -0,0 +1,50 @@
+package token
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"testing"
+)
+
+func TestHS256InvalidSigningSecret(t *testing.T) {
+	verifier, target := newTestVerifier(t)
+
+	claims, err := NewClaims(verifier.Issuer, "user-1", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "missing", secret: ""},
+		{name: "short", secret: base64.URLEncoding.EncodeToString([]byte("too-short"))},
+		{name: "not base64", secret: "not base64!"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			weak := *target
+			weak.SigningSecret = test.secret
+
+			_, err := SignHS256(claims, &weak)
+			if !errors.Is(err, ErrInvalidSigningSecret) {
+				t.Fatalf("expected ErrInvalidSigningSecret when signing, got %v", err)
+			}
+
+			secret, _ := base64.URLEncoding.DecodeString(test.secret)
+
+			forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = verifier.Verify(forged, &weak)
+			if !errors.Is(err, ErrInvalidSigningSecret) {
+				t.Fatalf("expected ErrInvalidSigningSecret when verifying, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/user"
+	"slices"
+	"time"
+)
+
+/*
+UserClaims - The OpenID Connect standard claims that simple-idp can provide for a user. Which
+claims are populated depends on the scopes that were granted
+*/
+type UserClaims struct {
+	// Name - The full name of the user. Provided by the profile scope
+	Name string `json:"name,omitempty"`
+
+	// PreferredUsername - The username of the user. Provided by the profile scope
+	PreferredUsername string `json:"preferred_username,omitempty"`
+
+	// UpdatedAt - The time the user was last modified, in seconds. Provided by the profile scope
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+
+	// Email - The email address of the user. Provided by the email scope
+	Email string `json:"email,omitempty"`
+
+	// EmailVerified - True if the user has verified their email address. Provided by the email scope
+	EmailVerified *bool `json:"email_verified,omitempty"`
+}
+
+/*
+NewUserClaims - A constructor for the UserClaims structure. Maps the fields of the user to the
+standard claims of the profile and email scopes, as defined in OpenID Connect Core Section 5.4
+*/
+func NewUserClaims(usr *user.User, scopes []string) *UserClaims {
+	claims := &UserClaims{}
+
+	if slices.Contains(scopes, "profile") {
+		claims.Name = usr.Username
+		claims.PreferredUsername = usr.Username
+		claims.UpdatedAt = time.Unix(0, usr.Metadata.ModifiedDate).Unix()
+	}
+
+	if slices.Contains(scopes, "email") {
+		verified := usr.EmailVerified
+		claims.Email = usr.Email
+		claims.EmailVerified = &verified
+	}
+
+	return claims
+}
+
+/*
+IDClaims - The claims that are embedded in each OpenID Connect ID token issued by simple-idp
+*/
+type IDClaims struct {
+	jwt.RegisteredClaims
+	UserClaims
+
+	// Nonce - The nonce sent by the application in the authorization request
+	Nonce string `json:"nonce,omitempty"`
+
+	// AuthTime - The time that the user last actively authenticated
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+
+	// AccessTokenHash - The left-most half of the hash of the access token issued alongside the ID token
+	AccessTokenHash string `json:"at_hash,omitempty"`
+
+	// CodeHash - The left-most half of the hash of the authorization code the ID token was issued for
+	CodeHash string `json:"c_hash,omitempty"`
+}
+
+/*
+NewIDClaims - A constructor for the IDClaims structure. ID tokens are always issued to the
+application that requested them, so the audience is the ClientID of the application
+*/
+func NewIDClaims(issuer string, clientId string, usr *user.User, scopes []string, lifetime time.Duration) (*IDClaims, error) {
+	identifier, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	return &IDClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   usr.Metadata.Id,
+			Audience:  jwt.ClaimStrings{clientId},
+			ExpiresAt: jwt.NewNumericDate(now.Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        identifier.String(),
+		},
+		UserClaims: *NewUserClaims(usr, scopes),
+	}, nil
+}
+
+/*
+HalfHash - Computes the at_hash or c_hash of a value as defined in OpenID Connect Core
+Section 3.1.3.6. The value is hashed with the hash function of the algorithm the ID token
+is signed with, and the left-most half of the digest is base64url encoded
+*/
+func HalfHash(value string, algorithm api.TokenType) string {
+	var digest []byte
+
+	switch algorithm {
+	case api.EdDSA:
+		sum := sha512.Sum512([]byte(value))
+		digest = sum[:]
+	default:
+		sum := sha256.Sum256([]byte(value))
+		digest = sum[:]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(digest[:len(digest)/2])
+}
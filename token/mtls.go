@@ -0,0 +1,42 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// ErrCertificateBindingMismatch - Gets returned by Verifier.VerifyRequest when a certificate-bound token is sent without the certificate it is bound to
+var ErrCertificateBindingMismatch = errors.New("token: Client certificate does not match the certificate the token is bound to")
+
+/*
+CertificateThumbprint - Computes the x5t#S256 confirmation method of a certificate, as defined in
+RFC 8705 Section 3.1. This is the base64url encoded SHA-256 hash of the DER encoding of the certificate
+*/
+func CertificateThumbprint(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(digest[:])
+}
+
+/*
+verifyCertificateBinding - Ensure that a certificate-bound token was sent over a TLS connection
+authenticated with the certificate it is bound to. Tokens that are not bound to a certificate
+are always accepted
+*/
+func verifyCertificateBinding(req *http.Request, claims *Claims) error {
+	if claims.Confirmation == nil || claims.Confirmation.CertificateThumbprint == "" {
+		return nil
+	}
+
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return ErrCertificateBindingMismatch
+	}
+
+	if CertificateThumbprint(req.TLS.PeerCertificates[0]) != claims.Confirmation.CertificateThumbprint {
+		return ErrCertificateBindingMismatch
+	}
+
+	return nil
+}
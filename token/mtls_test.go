@@ -0,0 +1,97 @@
+package token
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+/*
+newClientCertificate - Create a self-signed client certificate with the common name passed in the name parameter
+*/
+func newClientCertificate(t *testing.T, name string) *x509.Certificate {
+	t.Helper()
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private.PublicKey, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cert
+}
+
+func TestVerifyRequestCertificateBinding(t *testing.T) {
+	verifier, target := newTestVerifier(t)
+	cert := newClientCertificate(t, "client")
+	other := newClientCertificate(t, "other")
+
+	bearer := issueTestToken(t, verifier, target, nil)
+	bound := issueTestToken(t, verifier, target, &Confirmation{CertificateThumbprint: CertificateThumbprint(cert)})
+
+	tests := []struct {
+		name    string
+		token   string
+		tls     bool
+		peers   []*x509.Certificate
+		wantErr error
+	}{
+		{name: "unbound without TLS", token: bearer},
+		{name: "unbound with certificate", token: bearer, tls: true, peers: []*x509.Certificate{other}},
+		{name: "bound with certificate", token: bound, tls: true, peers: []*x509.Certificate{cert}},
+		{name: "bound with chain", token: bound, tls: true, peers: []*x509.Certificate{cert, other}},
+		{name: "bound without TLS", token: bound, wantErr: ErrCertificateBindingMismatch},
+		{name: "bound without certificate", token: bound, tls: true, wantErr: ErrCertificateBindingMismatch},
+		{name: "bound with another certificate", token: bound, tls: true, peers: []*x509.Certificate{other}, wantErr: ErrCertificateBindingMismatch},
+		{name: "bound with certificate later in chain", token: bound, tls: true, peers: []*x509.Certificate{other, cert}, wantErr: ErrCertificateBindingMismatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, testResource, nil)
+			req.Header.Set("Authorization", "Bearer "+test.token)
+
+			req.TLS = nil
+			if test.tls {
+				req.TLS = &tls.ConnectionState{PeerCertificates: test.peers}
+			}
+
+			_, err := verifier.VerifyRequest(req, target)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package token
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/metadata"
+	"github.com/stevezaluk/simple-idp-lib/rand"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"log/slog"
+	"time"
+)
+
+// ErrRefreshTokenDoesNotExist - Gets returned by ConsumeRefreshToken and GetRefreshToken when a refresh token does not exist, has expired or has been revoked
+var ErrRefreshTokenDoesNotExist = errors.New("token: Refresh token does not exist")
+
+// ErrRefreshTokenReused - Gets returned by ConsumeRefreshToken when a refresh token that has already been rotated is used again
+var ErrRefreshTokenReused = errors.New("token: Refresh token has already been used")
+
+// ErrCreateRefreshTokenFailed - Serves as a wrapper around database errors for the CreateRefreshToken function
+var ErrCreateRefreshTokenFailed = errors.New("token: Failed to create refresh token")
+
+// ErrConsumeRefreshTokenFailed - Serves as a wrapper around database errors for the ConsumeRefreshToken and GetRefreshToken functions
+var ErrConsumeRefreshTokenFailed = errors.New("token: Failed to consume refresh token")
+
+// ErrRevokeRefreshTokenFailed - Serves as a wrapper around database errors for the RevokeRefreshTokenFamily function
+var ErrRevokeRefreshTokenFailed = errors.New("token: Failed to revoke refresh token")
+
+/*
+RefreshToken - An opaque refresh token. Only the SHA-256 hash of the token is stored. Refresh
+tokens are rotated on every use, and every token descending from the same authorization grant
+shares a FamilyID so that the entire family can be revoked if a rotated token is replayed
+*/
+type RefreshToken struct {
+	// Metadata - General metadata for the structure
+	Metadata *metadata.Metadata `json:"metadata" bson:"metadata"`
+
+	// Hash - The hex encoded SHA-256 hash of the refresh token
+	Hash string `json:"hash" bson:"hash"`
+
+	// FamilyID - An identifier shared by every refresh token descending from the same grant
+	FamilyID string `json:"family_id" bson:"family_id"`
+
+	// ClientID - The ClientID of the application the refresh token was issued to
+	ClientID string `json:"client_id" bson:"client_id"`
+
+	// Subject - The ID of the user the refresh token was issued for
+	Subject string `json:"subject" bson:"subject"`
+
+	// Audience - The audience of the API that access tokens are issued for
+	Audience string `json:"audience" bson:"audience"`
+
+	// Scope - The scopes that were granted
+	Scope []string `json:"scope" bson:"scope"`
+
+	// AuthTime - The time that the user last actively authenticated
+	AuthTime int64 `json:"auth_time" bson:"auth_time"`
+
+	// Confirmation - The DPoP key the refresh token is bound to, if any. Rotating keeps the binding
+	Confirmation *Confirmation `json:"cnf,omitempty" bson:"cnf,omitempty"`
+
+	// Used - Set to true once the refresh token has been rotated
+	Used bool `json:"used" bson:"used"`
+
+	// FamilyExpiresAt - The absolute expiration of the family. Rotating does not extend this
+	FamilyExpiresAt time.Time `json:"family_expires_at" bson:"family_expires_at"`
+
+	// ExpiresAt - The time after which this refresh token can no longer be used. MongoDB removes it after this
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+NewRefreshToken - A constructor for the RefreshToken structure. Starts a new token family
+whose lifetimes are derived from the API the refresh token is issued for
+*/
+func NewRefreshToken(clientId string, subject string, target *api.API, scope []string, authTime int64) (*RefreshToken, error) {
+	meta, err := metadata.New()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	refresh := &RefreshToken{
+		Metadata:        meta,
+		FamilyID:        uuid.NewString(),
+		ClientID:        clientId,
+		Subject:         subject,
+		Audience:        target.Audience,
+		Scope:           scope,
+		AuthTime:        authTime,
+		FamilyExpiresAt: now.Add(time.Duration(target.RefreshTokenLifetime) * time.Second),
+	}
+	refresh.setExpiration(target, now)
+
+	return refresh, nil
+}
+
+/*
+Rotate - Create the successor of the refresh token. The successor belongs to the same family,
+keeps the absolute expiration of the family, and has its idle expiration reset
+*/
+func (refresh *RefreshToken) Rotate(target *api.API, scope []string) (*RefreshToken, error) {
+	meta, err := metadata.New()
+	if err != nil {
+		return nil, err
+	}
+
+	successor := &RefreshToken{
+		Metadata:        meta,
+		FamilyID:        refresh.FamilyID,
+		ClientID:        refresh.ClientID,
+		Subject:         refresh.Subject,
+		Audience:        refresh.Audience,
+		Scope:           scope,
+		AuthTime:        refresh.AuthTime,
+		Confirmation:    refresh.Confirmation,
+		FamilyExpiresAt: refresh.FamilyExpiresAt,
+	}
+	successor.setExpiration(target, time.Now().UTC())
+
+	return successor, nil
+}
+
+/*
+setExpiration - Set the expiration of the refresh token to whichever comes first, the idle
+expiration or the absolute expiration of the family
+*/
+func (refresh *RefreshToken) setExpiration(target *api.API, now time.Time) {
+	refresh.ExpiresAt = refresh.FamilyExpiresAt
+
+	if target.RefreshTokenIdleLifetime > 0 {
+		idle := now.Add(time.Duration(target.RefreshTokenIdleLifetime) * time.Second)
+		if idle.Before(refresh.ExpiresAt) {
+			refresh.ExpiresAt = idle
+		}
+	}
+}
+
+/*
+hashRefreshToken - Returns the hex encoded SHA-256 hash of a refresh token. Refresh tokens
+have enough entropy that a salt is not needed
+*/
+func hashRefreshToken(raw string) string {
+	digest := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(digest[:])
+}
+
+/*
+CreateRefreshToken - Generate the value of the refresh token and insert it into the database. The
+raw refresh token is returned, and is the only time it is available
+*/
+func CreateRefreshToken(database *server.Database, refresh *RefreshToken) (string, error) {
+	raw, err := rand.URLSafeString(32)
+	if err != nil {
+		return "", err
+	}
+
+	refresh.Hash = hashRefreshToken(raw)
+
+	err = database.Insert("refresh_token", refresh)
+	if err != nil {
+		return "", fmt.Errorf("%w: (%s)", ErrCreateRefreshTokenFailed, err)
+	}
+
+	return raw, nil
+}
+
+/*
+ConsumeRefreshToken - Atomically mark a refresh token as used and return it. If the refresh token
+has already been used, the entire family is revoked and ErrRefreshTokenReused is returned
+*/
+func ConsumeRefreshToken(database *server.Database, raw string) (*RefreshToken, error) {
+	var ret RefreshToken
+
+	hash := hashRefreshToken(raw)
+
+	err := database.FindAndUpdate(
+		"refresh_token",
+		bson.M{"hash": hash, "used": false},
+		bson.M{"$set": bson.M{"used": true}},
+		&ret,
+	)
+	if err == nil {
+		if ret.ExpiresAt.Before(time.Now().UTC()) {
+			return nil, ErrRefreshTokenDoesNotExist
+		}
+
+		return &ret, nil
+	}
+
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, fmt.Errorf("%w: (%s)", ErrConsumeRefreshTokenFailed, err)
+	}
+
+	err = database.Find("refresh_token", bson.M{"hash": hash}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrConsumeRefreshTokenFailed, err)
+	}
+
+	/*
+		A rotated refresh token should never be presented again. Either the application
+		or an attacker holds a stolen copy, and we cannot tell which, so every token in
+		the family is revoked
+	*/
+	slog.Warn("Refresh token was reused, revoking token family", "client_id", ret.ClientID, "family_id", ret.FamilyID)
+
+	err = RevokeRefreshTokenFamily(database, ret.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return nil, ErrRefreshTokenReused
+}
+
+/*
+GetRefreshToken - Fetch a refresh token using its raw value
+*/
+func GetRefreshToken(database *server.Database, raw string) (*RefreshToken, error) {
+	var ret RefreshToken
+
+	err := database.Find("refresh_token", bson.M{"hash": hashRefreshToken(raw)}, &ret)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrRefreshTokenDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrConsumeRefreshTokenFailed, err)
+	}
+
+	return &ret, nil
+}
+
+/*
+IsActive - Returns true if the refresh token has not been rotated and has not expired
+*/
+func (refresh *RefreshToken) IsActive() bool {
+	return !refresh.Used && refresh.ExpiresAt.After(time.Now().UTC())
+}
+
+/*
+RevokeRefreshTokenFamily - Remove every refresh token belonging to the family passed in the
+familyId parameter
+*/
+func RevokeRefreshTokenFamily(database *server.Database, familyId string) error {
+	err := database.DeleteMany("refresh_token", bson.M{"family_id": familyId})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeRefreshTokenFailed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"time"
+)
+
+// ErrTokenRevoked - Gets returned by Verifier.Verify when the jti of a token has been revoked
+var ErrTokenRevoked = errors.New("token: Token has been revoked")
+
+// ErrRevokeTokenFailed - Serves as a wrapper around database errors for the Revoke function
+var ErrRevokeTokenFailed = errors.New("token: Failed to revoke token")
+
+/*
+RevokedToken - An entry in the deny list. Tokens whose jti is present in the deny list are
+rejected, even if they have not expired yet
+*/
+type RevokedToken struct {
+	// ID - The jti of the revoked token
+	ID string `json:"jti" bson:"jti"`
+
+	// ExpiresAt - The expiration of the revoked token. The entry is not needed after this date
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
+}
+
+/*
+Revoke - Add the jti passed in the id parameter to the deny list. The entry is removed by MongoDB
+once the token has expired, as it can no longer be used after this
+*/
+func Revoke(database *server.Database, id string, expiresAt time.Time) error {
+	expiresAt = expiresAt.UTC()
+
+	ok, err := database.Exists("revoked_token", bson.M{"jti": id})
+	if err != nil {
+		return fmt.Errorf("%w: (%s)", ErrRevokeTokenFailed, err)
+	}
+
+	if !ok {
+		err = database.Insert("revoked_token", &RevokedToken{ID: id, ExpiresAt: expiresAt})
+		if err != nil {
+			return fmt.Errorf("%w: (%s)", ErrRevokeTokenFailed, err)
+		}
+	}
+
+	revocations.store(id, true, expiresAt, 0)
+
+	return nil
+}
+
+/*
+IsRevoked - Check to see if the jti passed in the id parameter is in the deny list. Results are
+cached in-process, so most calls do not reach the database. A jti that was found to not be revoked
+is trusted for the duration passed in the cacheTTL parameter. A cacheTTL of zero always checks the
+deny list for these
+*/
+func IsRevoked(database *server.Database, id string, cacheTTL time.Duration) (bool, error) {
+	revoked, ok := revocations.lookup(id, cacheTTL)
+	if ok {
+		return revoked, nil
+	}
+
+	var entry RevokedToken
+
+	err := database.Find("revoked_token", bson.M{"jti": id}, &entry)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			revocations.store(id, false, time.Time{}, cacheTTL)
+			return false, nil
+		}
+		return false, err
+	}
+
+	revocations.store(id, true, entry.ExpiresAt, 0)
+
+	return true, nil
+}
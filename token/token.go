@@ -0,0 +1,95 @@
+package token
+
+import (
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"time"
+)
+
+// ErrTokenExpired - Gets returned by Verifier.Verify when the exp claim of a token is in the past
+var ErrTokenExpired = errors.New("token: Token has expired")
+
+// ErrTokenNotValidYet - Gets returned by Verifier.Verify when the nbf or iat claim of a token is in the future
+var ErrTokenNotValidYet = errors.New("token: Token is not valid yet")
+
+// ErrInvalidAudience - Gets returned by Verifier.Verify when the aud claim does not contain the API's audience
+var ErrInvalidAudience = errors.New("token: Token audience is invalid")
+
+// ErrInvalidIssuer - Gets returned by Verifier.Verify when the iss claim does not match the expected issuer
+var ErrInvalidIssuer = errors.New("token: Token issuer is invalid")
+
+// ErrInvalidSignature - Gets returned by Verifier.Verify when the signature of a token could not be verified
+var ErrInvalidSignature = errors.New("token: Token signature is invalid")
+
+// ErrMalformedToken - Gets returned by Verifier.Verify when a token cannot be decoded
+var ErrMalformedToken = errors.New("token: Token is malformed")
+
+// ErrInvalidToken - Serves as a wrapper around any other validation errors returned by Verifier.Verify
+var ErrInvalidToken = errors.New("token: Token is invalid")
+
+// ErrInvalidAlgorithm - Gets returned when a token is signed or verified with an algorithm the API does not use
+var ErrInvalidAlgorithm = errors.New("token: Algorithm is not supported by this API")
+
+/*
+Claims - The claims that are embedded in each access token issued by simple-idp
+*/
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// Scope - A space delimited list of the scopes that were granted to the token
+	Scope string `json:"scope,omitempty"`
+
+	// ClientID - The ClientID of the application that the token was issued to
+	ClientID string `json:"client_id,omitempty"`
+
+	// Permissions - The permissions granted to the subject. Only included if API.AddPermissions is true
+	Permissions []string `json:"permissions,omitempty"`
+
+	// Actor - The party acting on behalf of the subject. Only included in tokens issued by token exchange
+	Actor *Actor `json:"act,omitempty"`
+
+	// Confirmation - The key the token is bound to. Only included in sender-constrained tokens
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+}
+
+/*
+Actor - The act claim defined in RFC 8693 Section 4.1. The outermost Actor is the current actor,
+and each nested Actor is a party that acted before it, forming the delegation chain
+*/
+type Actor struct {
+	// Subject - The subject of the acting party
+	Subject string `json:"sub"`
+
+	// ClientID - The ClientID of the application the acting party used
+	ClientID string `json:"client_id,omitempty"`
+
+	// Actor - The party that acted before this one
+	Actor *Actor `json:"act,omitempty"`
+}
+
+/*
+NewClaims - A constructor for the Claims structure. The audience and expiration of the
+token are derived from the API that the token is being issued for
+*/
+func NewClaims(issuer string, subject string, target *api.API) (*Claims, error) {
+	identifier, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	return &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{target.Audience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(target.TokenLifetime) * time.Second)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ID:        identifier.String(),
+		},
+	}, nil
+}
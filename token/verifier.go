@@ -0,0 +1,144 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/spf13/viper"
+	"github.com/stevezaluk/simple-idp-lib/api"
+	"github.com/stevezaluk/simple-idp-lib/server"
+	"time"
+)
+
+/*
+Verifier - Validates the signature and registered claims of tokens issued by simple-idp
+*/
+type Verifier struct {
+	// Issuer - The value that is expected in the iss claim of each token
+	Issuer string
+
+	// Leeway - The amount of clock skew that is tolerated when validating exp, nbf and iat
+	Leeway time.Duration
+
+	// RevocationCacheTTL - How long a jti that was found to not be revoked is trusted before the deny list is checked again
+	RevocationCacheTTL time.Duration
+
+	// database - The database that public keys and the deny list are fetched from
+	database *server.Database
+
+	// proofs - Where the DPoP proofs sent to resource servers are recorded. Always the database outside of tests
+	proofs proofStore
+}
+
+/*
+NewVerifier - A constructor for the Verifier structure
+*/
+func NewVerifier(database *server.Database, issuer string, leeway time.Duration) *Verifier {
+	return &Verifier{
+		Issuer:             issuer,
+		Leeway:             leeway,
+		RevocationCacheTTL: DefaultRevocationCacheTTL,
+		database:           database,
+		proofs:             database,
+	}
+}
+
+/*
+NewVerifierFromConfig - A wrapper around NewVerifier that fills in parameters from Viper. The
+leeway and the TTL of the revocation cache are expected to be provided in seconds
+*/
+func NewVerifierFromConfig(database *server.Database) *Verifier {
+	verifier := NewVerifier(
+		database,
+		viper.GetString("token.issuer"),
+		time.Duration(viper.GetInt("token.leeway"))*time.Second,
+	)
+
+	if viper.IsSet("token.revocation_cache_ttl") {
+		verifier.RevocationCacheTTL = time.Duration(viper.GetInt("token.revocation_cache_ttl")) * time.Second
+	}
+
+	return verifier
+}
+
+/*
+Verify - Parse the token passed in the raw parameter and validate it against the API it was
+issued for. Tokens that have been revoked are rejected. If the token is valid, its claims are returned
+*/
+func (verifier *Verifier) Verify(raw string, target *api.API) (*Claims, error) {
+	var claims Claims
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{string(target.TokenType)}),
+		jwt.WithIssuer(verifier.Issuer),
+		jwt.WithAudience(target.Audience),
+		jwt.WithLeeway(verifier.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+
+	_, err := parser.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch target.TokenType {
+		case api.HS256:
+			return hs256Key(target)
+		case api.RS256, api.ES256, api.EdDSA:
+			return asymmetricKey(verifier.database, token, target.TokenType)
+		default:
+			return nil, ErrInvalidAlgorithm
+		}
+	})
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	revoked, err := IsRevoked(verifier.database, claims.ID, verifier.RevocationCacheTTL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: (%s)", ErrInvalidToken, err)
+	}
+
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return &claims, nil
+}
+
+/*
+ParseUnverified - Decode the claims of a token without validating its signature. This must only
+be used to decide how a token should be verified, for example to find the API it was issued for
+*/
+func ParseUnverified(raw string) (*Claims, error) {
+	var claims Claims
+
+	_, _, err := jwt.NewParser().ParseUnverified(raw, &claims)
+	if err != nil {
+		return nil, ErrMalformedToken
+	}
+
+	return &claims, nil
+}
+
+/*
+translateError - Converts the errors returned by the jwt library into the errors
+exposed by this package
+*/
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, ErrInvalidSigningSecret):
+		return ErrInvalidSigningSecret
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return ErrMalformedToken
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return ErrInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return ErrInvalidAudience
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return ErrInvalidIssuer
+	}
+
+	return fmt.Errorf("%w: (%s)", ErrInvalidToken, err)
+}
@@ -45,6 +45,29 @@ func GetUser(database *server.Database, email string, excludeCreds bool) (*User,
 	return &ret, nil
 }
 
+/*
+GetUserByID - Fetch a users metadata using its ID. This is the value that is sent in the sub
+claim of tokens issued for the user
+*/
+func GetUserByID(database *server.Database, id string, excludeCreds bool) (*User, error) {
+	var ret User
+
+	exclusion := ""
+	if excludeCreds {
+		exclusion = "credentials"
+	}
+
+	err := database.Find("user", bson.M{"metadata.id": id}, &ret, exclusion)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrUserDoesNotExist
+		}
+		return nil, fmt.Errorf("%w: (%s)", ErrFetchUserFailed, err)
+	}
+
+	return &ret, nil
+}
+
 /*
 CheckUserExists - Check to see if a user already exists in the database
 */